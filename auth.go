@@ -1,8 +1,39 @@
 package greq
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+)
 
 type Authorization interface {
 	Prepare() error
 	Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error
 }
+
+// The parts of a request that an Authorization is allowed to modify
+type AuthTarget struct {
+	// The URL of the request, nil if the URL could not be parsed
+	URL *url.URL
+
+	AddHeader    func(key, value string)
+	AddQuery     func(key, value string)
+	AddCookie    func(cookie *http.Cookie)
+	SetTransport func(transport http.RoundTripper)
+}
+
+// An Authorization that needs to modify more than the headers and transport
+// of the request, for example query parameters or cookies.
+// If an Authorization implements this interface, ApplyTarget is called instead of Apply
+type TargetAuthorization interface {
+	Authorization
+	ApplyTarget(target *AuthTarget) error
+}
+
+// Apply an authorization to the target, using ApplyTarget if it is supported
+func applyAuth(auth Authorization, target *AuthTarget) error {
+	if ta, ok := auth.(TargetAuthorization); ok {
+		return ta.ApplyTarget(target)
+	}
+
+	return auth.Apply(target.AddHeader, target.SetTransport)
+}
@@ -0,0 +1,66 @@
+package greq
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Where the API key is placed in the request
+type APIKeyLocation string
+
+const (
+	APIKeyInHeader APIKeyLocation = "header"
+	APIKeyInQuery  APIKeyLocation = "query"
+	APIKeyInCookie APIKeyLocation = "cookie"
+)
+
+// Adds an API key to the request as a header, query parameter or cookie
+// The default location is the header
+type APIKeyAuth struct {
+	Key   string
+	Value string
+	In    APIKeyLocation
+}
+
+func (ak *APIKeyAuth) Prepare() error {
+	if ak.Key == "" {
+		return fmt.Errorf("api key name cannot be empty")
+	}
+
+	switch ak.In {
+	case "", APIKeyInHeader, APIKeyInQuery, APIKeyInCookie:
+		return nil
+	}
+
+	return fmt.Errorf("invalid api key location: %s", ak.In)
+}
+
+// Apply only has access to the headers, so a query key cannot be set from here.
+// Cookies are sent as a raw Cookie header, which replaces any other cookies on the request.
+func (ak *APIKeyAuth) Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error {
+	switch ak.In {
+	case "", APIKeyInHeader:
+		addHeaderFunc(ak.Key, ak.Value)
+	case APIKeyInCookie:
+		addHeaderFunc("Cookie", (&http.Cookie{Name: ak.Key, Value: ak.Value}).String())
+	default:
+		return fmt.Errorf("api key location %s is not supported by Apply, use ApplyTarget", ak.In)
+	}
+
+	return nil
+}
+
+func (ak *APIKeyAuth) ApplyTarget(target *AuthTarget) error {
+	switch ak.In {
+	case "", APIKeyInHeader:
+		target.AddHeader(ak.Key, ak.Value)
+	case APIKeyInQuery:
+		target.AddQuery(ak.Key, ak.Value)
+	case APIKeyInCookie:
+		target.AddCookie(&http.Cookie{Name: ak.Key, Value: ak.Value})
+	default:
+		return fmt.Errorf("invalid api key location: %s", ak.In)
+	}
+
+	return nil
+}
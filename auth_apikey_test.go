@@ -0,0 +1,53 @@
+package greq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("session")
+
+		if r.Header.Get("X-Api-Key") == "secret" ||
+			r.URL.Query().Get("api_key") == "secret" ||
+			(cookie != nil && cookie.Value == "secret") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tests := map[string]greq.APIKeyAuth{
+		"header": {Key: "X-Api-Key", Value: "secret"},
+		"query":  {Key: "api_key", Value: "secret", In: greq.APIKeyInQuery},
+		"cookie": {Key: "session", Value: "secret", In: greq.APIKeyInCookie},
+	}
+
+	for name, auth := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := greq.GetRequest(server.URL).WithAuth(&auth).Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Close()
+
+			if resp.StatusCode != 200 {
+				t.Errorf("expected status code 200, got %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthInvalidLocation(t *testing.T) {
+	auth := greq.APIKeyAuth{Key: "key", Value: "value", In: "body"}
+
+	if err := greq.GetRequest("http://localhost").WithAuth(&auth).Validate(); err == nil {
+		t.Fatal("expected an error for an invalid api key location")
+	}
+}
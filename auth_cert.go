@@ -3,23 +3,39 @@ package greq
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"net/http"
 	"os"
 
+	"github.com/youmark/pkcs8"
 	"software.sslmate.com/src/go-pkcs12"
 )
 
+// Authenticate with a client certificate (mTLS)
+// Errors from loading certificates are recorded and returned from Prepare,
+// so they surface when the auth is added to a request or validated
 type ClientCertificateAuth struct {
 	ClientCertificate  tls.Certificate
 	CaCertificates     *x509.CertPool
 	InsecureSkipVerify bool
+
+	// Only trust the added CA certificates, instead of adding them to the system roots
+	ExcludeSystemRoots bool
+
+	caCerts []*x509.Certificate
+	err     error
 }
 
 func (ca ClientCertificateAuth) Prepare() error {
-	return nil
+	return ca.err
 }
 
 func (ca ClientCertificateAuth) Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error {
+	if ca.err != nil {
+		return ca.err
+	}
+
 	customTransport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			Certificates:       []tls.Certificate{ca.ClientCertificate},
@@ -27,32 +43,112 @@ func (ca ClientCertificateAuth) Apply(addHeaderFunc func(key, value string), set
 		},
 	}
 
-	if ca.CaCertificates != nil {
-		customTransport.TLSClientConfig.RootCAs = ca.CaCertificates
+	rootCAs, err := ca.rootCAs()
+	if err != nil {
+		return err
 	}
 
+	customTransport.TLSClientConfig.RootCAs = rootCAs
+
 	setTransportFunc(customTransport)
 	return nil
 }
 
+// Build the pool of root CAs to verify the server with
+// A CertPool from WithCaCertificates replaces the system roots, added CA certificates
+// are merged with them unless ExcludeSystemRoots is set.
+// Returns nil if the system roots should be used as-is
+func (ca ClientCertificateAuth) rootCAs() (*x509.CertPool, error) {
+	var pool *x509.CertPool
+
+	switch {
+	case ca.CaCertificates != nil:
+		pool = ca.CaCertificates.Clone()
+	case len(ca.caCerts) == 0:
+		return nil, nil
+	case ca.ExcludeSystemRoots:
+		pool = x509.NewCertPool()
+	default:
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+
+		pool = systemPool.Clone()
+	}
+
+	for _, cert := range ca.caCerts {
+		pool.AddCert(cert)
+	}
+
+	return pool, nil
+}
+
 func NewClientCertificateAuth() *ClientCertificateAuth {
 	return &ClientCertificateAuth{}
 }
 
-func (ca *ClientCertificateAuth) FromX509(certFile, keyFile string) *ClientCertificateAuth {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		panic(err)
+// Load a client certificate from PEM files, returning any errors directly
+// The password is only used if the key is encrypted and can be left empty otherwise
+func LoadX509ClientCertificate(certFile, keyFile, password string) (*ClientCertificateAuth, error) {
+	ca := NewClientCertificateAuth().FromEncryptedX509(certFile, keyFile, password)
+	return ca, ca.err
+}
+
+// Load a client certificate from a PKCS12 file, returning any errors directly
+func LoadPKCS12ClientCertificate(pkcs12File, password string) (*ClientCertificateAuth, error) {
+	ca := NewClientCertificateAuth().FromPKCS12(pkcs12File, password)
+	return ca, ca.err
+}
+
+// Get the first error that occurred while loading certificates
+func (ca *ClientCertificateAuth) Err() error {
+	return ca.err
+}
+
+func (ca *ClientCertificateAuth) setError(err error) *ClientCertificateAuth {
+	if ca.err == nil {
+		ca.err = err
 	}
 
-	ca.ClientCertificate = cert
 	return ca
 }
 
+func (ca *ClientCertificateAuth) FromX509(certFile, keyFile string) *ClientCertificateAuth {
+	return ca.FromEncryptedX509(certFile, keyFile, "")
+}
+
 func (ca *ClientCertificateAuth) FromX509Bytes(cert, key []byte) *ClientCertificateAuth {
+	return ca.FromEncryptedX509Bytes(cert, key, "")
+}
+
+// Load a client certificate from PEM files where the key may be encrypted
+// Supports encrypted PKCS8 keys and legacy encrypted PEM keys
+func (ca *ClientCertificateAuth) FromEncryptedX509(certFile, keyFile, password string) *ClientCertificateAuth {
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		return ca.setError(err)
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return ca.setError(err)
+	}
+
+	return ca.FromEncryptedX509Bytes(cert, key, password)
+}
+
+// Load a client certificate from PEM data where the key may be encrypted
+// Supports encrypted PKCS8 keys and legacy encrypted PEM keys
+func (ca *ClientCertificateAuth) FromEncryptedX509Bytes(cert, key []byte, password string) *ClientCertificateAuth {
+	key, err := decryptPEMKey(key, password)
+	if err != nil {
+		return ca.setError(err)
+	}
+
 	certPair, err := tls.X509KeyPair(cert, key)
 	if err != nil {
-		panic(err)
+		return ca.setError(err)
 	}
 
 	ca.ClientCertificate = certPair
@@ -60,11 +156,107 @@ func (ca *ClientCertificateAuth) FromX509Bytes(cert, key []byte) *ClientCertific
 	return ca
 }
 
+// Decrypt the private key in PEM data, returning it as an unencrypted PKCS8 PEM block
+// Unencrypted keys are returned unchanged
+func decryptPEMKey(data []byte, password string) ([]byte, error) {
+	rest := data
+
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return data, nil
+		}
+
+		var der []byte
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if password == "" {
+				return nil, fmt.Errorf("private key is encrypted, but no password was given")
+			}
+
+			key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+			}
+
+			der, err = x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return nil, err
+			}
+
+		//lint:ignore SA1019 legacy encrypted keys are still common
+		case x509.IsEncryptedPEMBlock(block):
+			if password == "" {
+				return nil, fmt.Errorf("private key is encrypted, but no password was given")
+			}
+
+			//lint:ignore SA1019 legacy encrypted keys are still common
+			decrypted, err := x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+			}
+
+			return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: decrypted}), nil
+
+		default:
+			continue
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+}
+
 func (ca *ClientCertificateAuth) WithCaCertificates(caCertificates *x509.CertPool) *ClientCertificateAuth {
 	ca.CaCertificates = caCertificates
 	return ca
 }
 
+// Add CA certificates to trust when verifying the server
+// Unlike WithCaCertificates, these are added to the system roots
+func (ca *ClientCertificateAuth) AddCaCertificates(certs ...*x509.Certificate) *ClientCertificateAuth {
+	ca.caCerts = append(ca.caCerts, certs...)
+	return ca
+}
+
+// Add PEM encoded CA certificates to trust when verifying the server
+func (ca *ClientCertificateAuth) AddCaCertificatesPEM(data []byte) *ClientCertificateAuth {
+	found := false
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return ca.setError(err)
+		}
+
+		ca.caCerts = append(ca.caCerts, cert)
+		found = true
+	}
+
+	if !found {
+		return ca.setError(fmt.Errorf("no certificates found in CA PEM data"))
+	}
+
+	return ca
+}
+
+// Trust the system roots in addition to the added CA certificates, enabled by default
+func (ca *ClientCertificateAuth) WithSystemRoots(useSystemRoots bool) *ClientCertificateAuth {
+	ca.ExcludeSystemRoots = !useSystemRoots
+	return ca
+}
+
 func (ca *ClientCertificateAuth) WithInsecureSkipVerify(insecureSkipVerify bool) *ClientCertificateAuth {
 	ca.InsecureSkipVerify = insecureSkipVerify
 	return ca
@@ -73,29 +265,32 @@ func (ca *ClientCertificateAuth) WithInsecureSkipVerify(insecureSkipVerify bool)
 func (ca *ClientCertificateAuth) FromPKCS12(pkcs12File, password string) *ClientCertificateAuth {
 	contents, err := os.ReadFile(pkcs12File)
 	if err != nil {
-		panic(err)
+		return ca.setError(err)
 	}
 
-	ca.FromPKCS12Bytes(contents, password)
-
-	return ca
+	return ca.FromPKCS12Bytes(contents, password)
 }
 
+// Load the client certificate, key and chain from PKCS12 data
+// The full chain is sent to the server, and the chain certificates are
+// also trusted as CA certificates, in addition to the system roots
 func (ca *ClientCertificateAuth) FromPKCS12Bytes(pkcs12Data []byte, password string) *ClientCertificateAuth {
 	privkey, certificate, cachain, err := pkcs12.DecodeChain(pkcs12Data, password)
 	if err != nil {
-		panic(err)
+		return ca.setError(err)
 	}
 
 	ca.ClientCertificate = tls.Certificate{
 		Certificate: [][]byte{certificate.Raw},
 		PrivateKey:  privkey,
+		Leaf:        certificate,
 	}
 
-	ca.CaCertificates = x509.NewCertPool()
 	for _, cert := range cachain {
-		ca.CaCertificates.AddCert(cert)
+		ca.ClientCertificate.Certificate = append(ca.ClientCertificate.Certificate, cert.Raw)
 	}
 
+	ca.caCerts = append(ca.caCerts, cachain...)
+
 	return ca
 }
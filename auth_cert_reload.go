@@ -0,0 +1,221 @@
+package greq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Authenticate with a client certificate that is reloaded from disk when the files change
+// The files are checked at most once per Interval during TLS handshakes, so rotated
+// certificates and keys are picked up without recreating the client. A rotated CA
+// bundle is picked up by the next request the auth is added to.
+// If a reload fails, the previous certificates are kept and OnReloadError is called.
+type ReloadingCertificateAuth struct {
+	CertFile string
+	KeyFile  string
+	// Password for an encrypted key, can be left empty
+	Password string
+
+	// Optional CA bundle to verify the server with, added to the system roots
+	CaFile string
+	// Only trust the CA bundle, instead of adding it to the system roots
+	ExcludeSystemRoots bool
+
+	// How often the files are checked for changes, defaults to one minute
+	Interval time.Duration
+	// Called when reloading the files fails
+	OnReloadError func(err error)
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	rootCAs   *x509.CertPool
+	fileState map[string]fileState
+	lastCheck time.Time
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewReloadingCertificateAuth(certFile, keyFile string) *ReloadingCertificateAuth {
+	return &ReloadingCertificateAuth{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+}
+
+func (ra *ReloadingCertificateAuth) WithPassword(password string) *ReloadingCertificateAuth {
+	ra.Password = password
+	return ra
+}
+
+func (ra *ReloadingCertificateAuth) WithCaFile(caFile string, useSystemRoots bool) *ReloadingCertificateAuth {
+	ra.CaFile = caFile
+	ra.ExcludeSystemRoots = !useSystemRoots
+	return ra
+}
+
+func (ra *ReloadingCertificateAuth) WithInterval(interval time.Duration) *ReloadingCertificateAuth {
+	ra.Interval = interval
+	return ra
+}
+
+func (ra *ReloadingCertificateAuth) WithReloadErrorHandler(handler func(err error)) *ReloadingCertificateAuth {
+	ra.OnReloadError = handler
+	return ra
+}
+
+// Load the certificates if they have not been loaded yet
+func (ra *ReloadingCertificateAuth) Prepare() error {
+	ra.mu.RLock()
+	loaded := ra.cert != nil
+	ra.mu.RUnlock()
+
+	if loaded {
+		return nil
+	}
+
+	return ra.Reload()
+}
+
+func (ra *ReloadingCertificateAuth) Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error {
+	tlsConfig := &tls.Config{
+		GetClientCertificate: ra.getClientCertificate,
+	}
+
+	// RootCAs cannot be swapped on an existing config, so the CA bundle is
+	// reloaded when the auth is applied to a request
+	if ra.CaFile != "" {
+		ra.reloadIfChanged()
+
+		ra.mu.RLock()
+		tlsConfig.RootCAs = ra.rootCAs
+		ra.mu.RUnlock()
+	}
+
+	setTransportFunc(&http.Transport{TLSClientConfig: tlsConfig})
+	return nil
+}
+
+// Load the certificate, key and CA bundle from disk, replacing the current ones
+func (ra *ReloadingCertificateAuth) Reload() error {
+	files := []string{ra.CertFile, ra.KeyFile}
+	if ra.CaFile != "" {
+		files = append(files, ra.CaFile)
+	}
+
+	state, err := statFiles(files)
+	if err != nil {
+		return err
+	}
+
+	loader := NewClientCertificateAuth().FromEncryptedX509(ra.CertFile, ra.KeyFile, ra.Password)
+
+	if ra.CaFile != "" {
+		caData, err := os.ReadFile(ra.CaFile)
+		if err != nil {
+			return err
+		}
+
+		loader = loader.AddCaCertificatesPEM(caData).WithSystemRoots(!ra.ExcludeSystemRoots)
+	}
+
+	if loader.Err() != nil {
+		return loader.Err()
+	}
+
+	var rootCAs *x509.CertPool
+	if ra.CaFile != "" {
+		if rootCAs, err = loader.rootCAs(); err != nil {
+			return err
+		}
+	}
+
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.cert = &loader.ClientCertificate
+	ra.rootCAs = rootCAs
+	ra.fileState = state
+	ra.lastCheck = time.Now()
+
+	return nil
+}
+
+// Reload the files if the interval has passed and any of them have changed
+func (ra *ReloadingCertificateAuth) reloadIfChanged() {
+	interval := ra.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	ra.mu.Lock()
+	if time.Since(ra.lastCheck) < interval {
+		ra.mu.Unlock()
+		return
+	}
+
+	ra.lastCheck = time.Now()
+	previous := ra.fileState
+	ra.mu.Unlock()
+
+	files := make([]string, 0, len(previous))
+	for name := range previous {
+		files = append(files, name)
+	}
+
+	current, err := statFiles(files)
+	if err == nil {
+		changed := false
+		for name, st := range current {
+			if previous[name] != st {
+				changed = true
+				break
+			}
+		}
+
+		if !changed {
+			return
+		}
+
+		err = ra.Reload()
+	}
+
+	if err != nil && ra.OnReloadError != nil {
+		ra.OnReloadError(err)
+	}
+}
+
+func (ra *ReloadingCertificateAuth) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	ra.reloadIfChanged()
+
+	ra.mu.RLock()
+	defer ra.mu.RUnlock()
+
+	if ra.cert == nil {
+		return nil, fmt.Errorf("client certificate has not been loaded")
+	}
+
+	return ra.cert, nil
+}
+
+func statFiles(files []string) (map[string]fileState, error) {
+	state := make(map[string]fileState, len(files))
+
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		state[name] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return state, nil
+}
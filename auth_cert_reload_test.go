@@ -0,0 +1,180 @@
+package greq_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+func createNamedClientCert(ca *CaCertCollection, name string) CertCollection {
+	return ca.GetSignedCert(&x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(0, 0, 1),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func writeCertFiles(t *testing.T, dir string, cert CertCollection, modTime time.Time) {
+	for name, data := range map[string][]byte{"client.crt": cert.CertPEM, "client.key": cert.CertPrivkeyPEM} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReloadingCertificateAuth(t *testing.T) {
+	ca := PrepareCA()
+	serverCert := ca.CreateServerCert()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.CaPEM)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.Cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	url := fmt.Sprintf("https://localhost:%d", server.Listener.Addr().(*net.TCPAddr).Port)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.CaPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCertFiles(t, dir, createNamedClientCert(&ca, "first"), time.Now().Add(-time.Hour))
+
+	var reloadErr error
+
+	auth := greq.NewReloadingCertificateAuth(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")).
+		WithCaFile(caFile, false).
+		WithInterval(time.Nanosecond).
+		WithReloadErrorHandler(func(err error) { reloadErr = err })
+
+	expectName := func(expected string) {
+		t.Helper()
+
+		resp, err := greq.GetRequest(url).WithAuth(auth).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := resp.BodyString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body != expected {
+			t.Fatalf("expected client certificate %s, got %s", expected, body)
+		}
+	}
+
+	expectName("first")
+
+	writeCertFiles(t, dir, createNamedClientCert(&ca, "second"), time.Now())
+	expectName("second")
+
+	// A broken rotation keeps the previous certificate and reports the error
+	if err := os.WriteFile(filepath.Join(dir, "client.crt"), []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expectName("second")
+
+	if reloadErr == nil {
+		t.Fatal("expected the reload error to be reported")
+	}
+}
+
+func TestReloadingCertificateAuthMerge(t *testing.T) {
+	ca := PrepareCA()
+	other := PrepareCA()
+	serverCert := ca.CreateServerCert()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.CaPEM)
+
+	otherPool := x509.NewCertPool()
+	otherPool.AppendCertsFromPEM(other.CaPEM)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.Cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	url := fmt.Sprintf("https://localhost:%d", server.Listener.Addr().(*net.TCPAddr).Port)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.CaPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCertFiles(t, dir, createNamedClientCert(&ca, "reloaded"), time.Now())
+
+	newAuth := func() *greq.ReloadingCertificateAuth {
+		return greq.NewReloadingCertificateAuth(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")).WithCaFile(caFile, false)
+	}
+
+	// The root CAs of another authorization are not silently ignored
+	chain := greq.NewChainAuth(newAuth(), &greq.ClientCertificateAuth{CaCertificates: otherPool})
+	if err := greq.GetRequest(url).WithAuth(chain).Validate(); err == nil {
+		t.Error("expected an error when merging different root CAs")
+	}
+
+	// A static client certificate would be replaced by the reloaded one
+	chain = greq.NewChainAuth(newAuth(), &greq.ClientCertificateAuth{ClientCertificate: ca.CreateClientCert().Cert})
+	if err := greq.GetRequest(url).WithAuth(chain).Validate(); err == nil {
+		t.Error("expected an error when merging static and reloaded client certificates")
+	}
+
+	// The chain is verified against the CA bundle, so the CA key can be pinned
+	caCert, err := x509.ParseCertificate(ca.CABytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := greq.GetRequest(url).
+		WithAuth(newAuth()).
+		WithTLSConfig(greq.TLSOptions{PinnedSPKI: []string{greq.SPKIHash(caCert)}}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if _, err := greq.GetRequest(url).WithAuth(newAuth()).WithTLSConfig(greq.TLSOptions{RootCAs: otherPool}).Execute(); err == nil {
+		t.Error("expected the root CAs from the TLS options to be used")
+	}
+}
@@ -8,13 +8,18 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/clysec/greq"
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 type CaCertCollection struct {
@@ -215,3 +220,129 @@ func TestCertificateAuth(t *testing.T) {
 	}
 
 }
+
+func TestCertificateAuthInvalidInput(t *testing.T) {
+	auth := greq.NewClientCertificateAuth().FromX509Bytes([]byte("not a cert"), []byte("not a key"))
+	if auth.Err() == nil {
+		t.Fatal("expected an error for invalid certificate data")
+	}
+
+	if err := greq.GetRequest("https://localhost").WithAuth(auth).Validate(); err == nil {
+		t.Fatal("expected the certificate error to surface through Validate")
+	}
+
+	if _, err := greq.LoadPKCS12ClientCertificate("testfiles/does-not-exist.p12", ""); err == nil {
+		t.Fatal("expected an error for a missing PKCS12 file")
+	}
+}
+
+func TestCertificateAuthEncryptedKey(t *testing.T) {
+	ca := PrepareCA()
+	client := ca.CreateClientCert()
+
+	der, err := pkcs8.MarshalPrivateKey(client.Cert.PrivateKey, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der})
+
+	if auth := greq.NewClientCertificateAuth().FromX509Bytes(client.CertPEM, keyPEM); auth.Err() == nil {
+		t.Fatal("expected an error for an encrypted key without a password")
+	}
+
+	if auth := greq.NewClientCertificateAuth().FromEncryptedX509Bytes(client.CertPEM, keyPEM, "wrong"); auth.Err() == nil {
+		t.Fatal("expected an error for an encrypted key with the wrong password")
+	}
+
+	auth := greq.NewClientCertificateAuth().FromEncryptedX509Bytes(client.CertPEM, keyPEM, "secret")
+	if auth.Err() != nil {
+		t.Fatal(auth.Err())
+	}
+}
+
+func TestCertificateAuthPKCS12Chain(t *testing.T) {
+	ca := PrepareCA()
+	client := ca.CreateClientCert()
+
+	leaf, err := x509.ParseCertificate(client.Cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := x509.ParseCertificate(ca.CABytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pfx, err := pkcs12.Modern.Encode(client.Cert.PrivateKey, leaf, []*x509.Certificate{caCert}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := greq.NewClientCertificateAuth().FromPKCS12Bytes(pfx, "secret").WithSystemRoots(true)
+	if auth.Err() != nil {
+		t.Fatal(auth.Err())
+	}
+
+	if len(auth.ClientCertificate.Certificate) != 2 {
+		t.Fatalf("expected the leaf and chain certificate, got %d certificates", len(auth.ClientCertificate.Certificate))
+	}
+
+	if err := greq.GetRequest("https://localhost").WithAuth(auth).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateAuthPKCS12ChainTrust(t *testing.T) {
+	ca := PrepareCA()
+	client := ca.CreateClientCert()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{ca.CreateServerCert().Cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	leaf, err := x509.ParseCertificate(client.Cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := x509.ParseCertificate(ca.CABytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pfx, err := pkcs12.Modern.Encode(client.Cert.PrivateKey, leaf, []*x509.Certificate{caCert}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	// The chain of the client certificate is trusted for the server, with or without the system roots
+	for _, systemRoots := range []bool{true, false} {
+		auth := greq.NewClientCertificateAuth().FromPKCS12Bytes(pfx, "secret").WithSystemRoots(systemRoots)
+		resp, err := greq.GetRequest(url).WithAuth(auth).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	// Without the chain the server is not trusted
+	auth := greq.NewClientCertificateAuth().FromX509Bytes(client.CertPEM, client.CertPrivkeyPEM)
+	if _, err := greq.GetRequest(url).WithAuth(auth).Execute(); !errors.Is(err, greq.ErrTLS) {
+		t.Errorf("expected a TLS error, got %v", err)
+	}
+
+	// Added CA certificates are merged with the system roots
+	auth = greq.NewClientCertificateAuth().FromX509Bytes(client.CertPEM, client.CertPrivkeyPEM).AddCaCertificatesPEM(ca.CaPEM)
+	resp, err := greq.GetRequest(url).WithAuth(auth).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
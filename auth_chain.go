@@ -0,0 +1,102 @@
+package greq
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Combines multiple authorizations into one, for example a client certificate and a bearer token
+// The authorizations are applied in order, with the following rules:
+// - a header can only be set by one of the authorizations, setting it twice is an error
+// - query parameters and cookies from all authorizations are added
+// - transports are merged, see mergeTransports for the rules
+type ChainAuth struct {
+	Auths []Authorization
+}
+
+func NewChainAuth(auths ...Authorization) *ChainAuth {
+	return &ChainAuth{Auths: auths}
+}
+
+func (ca *ChainAuth) Prepare() error {
+	for _, auth := range ca.Auths {
+		if err := auth.Prepare(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ca *ChainAuth) Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error {
+	var err error
+
+	unsupported := func(kind string) {
+		if err == nil {
+			err = fmt.Errorf("chained authorization adds %s, which is not supported by Apply, use ApplyTarget", kind)
+		}
+	}
+
+	if applyErr := ca.ApplyTarget(&AuthTarget{
+		AddHeader:    addHeaderFunc,
+		AddQuery:     func(key, value string) { unsupported("query parameters") },
+		AddCookie:    func(cookie *http.Cookie) { unsupported("cookies") },
+		SetTransport: setTransportFunc,
+	}); applyErr != nil {
+		return applyErr
+	}
+
+	return err
+}
+
+func (ca *ChainAuth) ApplyTarget(target *AuthTarget) error {
+	headers := map[string]bool{}
+
+	var transport http.RoundTripper
+	var err error
+
+	chained := &AuthTarget{
+		URL: target.URL,
+		AddHeader: func(key, value string) {
+			canonical := http.CanonicalHeaderKey(key)
+			if headers[canonical] {
+				if err == nil {
+					err = fmt.Errorf("header %s is set by more than one chained authorization", canonical)
+				}
+				return
+			}
+
+			headers[canonical] = true
+			target.AddHeader(key, value)
+		},
+		AddQuery:  target.AddQuery,
+		AddCookie: target.AddCookie,
+		SetTransport: func(t http.RoundTripper) {
+			merged, mergeErr := mergeTransports(transport, t)
+			if mergeErr != nil {
+				if err == nil {
+					err = mergeErr
+				}
+				return
+			}
+
+			transport = merged
+		},
+	}
+
+	for _, auth := range ca.Auths {
+		if applyErr := applyAuth(auth, chained); applyErr != nil {
+			return applyErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if transport != nil {
+		target.SetTransport(transport)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package greq_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+func TestChainAuthCertificateAndBearer(t *testing.T) {
+	ca := PrepareCA()
+	serverCert := ca.CreateServerCert()
+	clientCert := ca.CreateClientCert()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.CaPEM)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.Cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	auth := greq.NewChainAuth(
+		&greq.ClientCertificateAuth{ClientCertificate: clientCert.Cert, CaCertificates: pool},
+		&greq.BearerAuth{Token: "token"},
+	)
+
+	url := fmt.Sprintf("https://localhost:%d", server.Listener.Addr().(*net.TCPAddr).Port)
+
+	resp, err := greq.GetRequest(url).WithAuth(auth).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestChainAuthHeaderConflict(t *testing.T) {
+	auth := greq.NewChainAuth(
+		&greq.BasicAuth{Username: "user", Password: "pass"},
+		&greq.BearerAuth{Token: "token"},
+	)
+
+	if err := greq.GetRequest("http://localhost").WithAuth(auth).Validate(); err == nil {
+		t.Fatal("expected an error when two chained authorizations set the same header")
+	}
+}
+
+func TestAuthRouter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	router := greq.NewAuthRouter().
+		Route("*.example.com", &greq.BearerAuth{Token: "example"}).
+		Route(fmt.Sprintf("127.0.0.1:%d/admin", port), &greq.BearerAuth{Token: "admin"}).
+		Route("127.0.0.1", &greq.BearerAuth{Token: "local"})
+
+	tests := map[string]string{
+		"/":            "Bearer local",
+		"/admin":       "Bearer admin",
+		"/admin/users": "Bearer admin",
+		"/administer":  "Bearer local",
+	}
+
+	for path, expected := range tests {
+		resp, err := greq.GetRequest(server.URL + path).WithAuth(router).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := resp.BodyString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, body)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package greq
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A username and password resolved by a CredentialHelper
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Resolves credentials for a request URL
+// Returns nil credentials and a nil error if there are no credentials for the URL
+type CredentialHelper interface {
+	Credentials(u *url.URL) (*Credentials, error)
+}
+
+// Resolves credentials from a netrc file
+// If Path is empty, the NETRC environment variable is used, falling back to
+// ~/.netrc (~/_netrc on windows)
+type NetrcHelper struct {
+	Path string
+}
+
+func (nh *NetrcHelper) path() (string, error) {
+	if nh.Path != "" {
+		return nh.Path, nil
+	}
+
+	if env := os.Getenv("NETRC"); env != "" {
+		return env, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc"), nil
+	}
+
+	return filepath.Join(home, ".netrc"), nil
+}
+
+func (nh *NetrcHelper) Credentials(u *url.URL) (*Credentials, error) {
+	path, err := nh.path()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && nh.Path == "" {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return parseNetrc(data, u.Hostname())
+}
+
+// Find the credentials for a host in netrc data, falling back to the default entry
+func parseNetrc(data []byte, host string) (*Credentials, error) {
+	var found, fallback *Credentials
+	var current *Credentials
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inMacro := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Macro definitions run until the next empty line
+		if inMacro {
+			if strings.TrimSpace(line) == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("netrc: machine without a name")
+				}
+
+				i++
+				current = nil
+				if found == nil && strings.EqualFold(fields[i], host) {
+					found = &Credentials{}
+					current = found
+				}
+			case "default":
+				current = nil
+				if fallback == nil {
+					fallback = &Credentials{}
+					current = fallback
+				}
+			case "login", "password", "account":
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("netrc: %s without a value", fields[i])
+				}
+
+				i++
+				if current == nil {
+					continue
+				}
+
+				if fields[i-1] == "login" {
+					current.Username = fields[i]
+				} else if fields[i-1] == "password" {
+					current.Password = fields[i]
+				}
+			case "macdef":
+				current = nil
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if found != nil {
+		return found, nil
+	}
+
+	return fallback, nil
+}
+
+// Resolves credentials with an external helper program using the git-credential protocol
+// The helper is called with the argument "get", receives the protocol and host on stdin
+// and should print username= and password= lines to stdout
+type ExecCredentialHelper struct {
+	Command string
+	Args    []string
+	// Additional environment variables for the helper, in the form KEY=value
+	Env []string
+	// Also send the path of the URL, like git's credential.useHttpPath
+	// Credentials are then cached per path instead of per host.
+	UseHTTPPath bool
+}
+
+func (eh *ExecCredentialHelper) usesPath() bool {
+	return eh.UseHTTPPath
+}
+
+func (eh *ExecCredentialHelper) Credentials(u *url.URL) (*Credentials, error) {
+	// A newline would let the URL inject attributes, for example a second host
+	for name, value := range map[string]string{"protocol": u.Scheme, "host": u.Host, "path": u.Path} {
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("credential helper: the %s contains a newline or NUL character", name)
+		}
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+	if path := strings.TrimPrefix(u.Path, "/"); eh.UseHTTPPath && path != "" {
+		input += fmt.Sprintf("path=%s\n", path)
+	}
+
+	args := append(append([]string{}, eh.Args...), "get")
+	cmd := exec.Command(eh.Command, args...)
+	cmd.Env = append(os.Environ(), eh.Env...)
+	cmd.Stdin = strings.NewReader(input + "\n")
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s failed: %w: %s", eh.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	creds := &Credentials{}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "username":
+			creds.Username = value
+		case "password":
+			creds.Password = value
+		}
+	}
+
+	if creds.Username == "" && creds.Password == "" {
+		return nil, nil
+	}
+
+	return creds, nil
+}
+
+// Resolves credentials from a fixed map of hosts, useful for testing
+// Hosts can be given with or without a port, the entry with a port is preferred
+type StaticCredentialHelper map[string]Credentials
+
+func (sh StaticCredentialHelper) Credentials(u *url.URL) (*Credentials, error) {
+	if creds, ok := sh[u.Host]; ok {
+		return &creds, nil
+	}
+
+	if creds, ok := sh[u.Hostname()]; ok {
+		return &creds, nil
+	}
+
+	return nil, nil
+}
+
+// A helper that receives the path of the URL, so credentials are cached per path
+type pathCredentialHelper interface {
+	usesPath() bool
+}
+
+type cachedCredentials struct {
+	creds     *Credentials
+	expiresAt time.Time
+}
+
+// Sets the Authorization header with Basic Auth credentials resolved per host by a CredentialHelper
+// Resolved credentials are cached per scheme and host, and per path for helpers that use it. A CacheTTL of 0 caches them for the
+// lifetime of the CredentialHelperAuth. If no credentials are found, no header is added.
+type CredentialHelperAuth struct {
+	Helper   CredentialHelper
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedCredentials
+}
+
+func NewCredentialHelperAuth(helper CredentialHelper) *CredentialHelperAuth {
+	return &CredentialHelperAuth{Helper: helper}
+}
+
+// Resolve credentials from a netrc file, see NetrcHelper for how an empty path is handled
+func NewNetrcAuth(path string) *CredentialHelperAuth {
+	return NewCredentialHelperAuth(&NetrcHelper{Path: path})
+}
+
+func (ch *CredentialHelperAuth) Prepare() error {
+	if ch.Helper == nil {
+		return fmt.Errorf("credential helper is required")
+	}
+
+	return nil
+}
+
+func (ch *CredentialHelperAuth) Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error {
+	return fmt.Errorf("credential helper auth needs the request url, use ApplyTarget")
+}
+
+func (ch *CredentialHelperAuth) ApplyTarget(target *AuthTarget) error {
+	if target.URL == nil {
+		return fmt.Errorf("credential helper auth needs a valid request url")
+	}
+
+	creds, err := ch.lookup(target.URL)
+	if err != nil || creds == nil {
+		return err
+	}
+
+	return (&BasicAuth{Username: creds.Username, Password: creds.Password}).Apply(target.AddHeader, target.SetTransport)
+}
+
+// Look up credentials for a URL, using the cache if possible
+func (ch *CredentialHelperAuth) lookup(u *url.URL) (*Credentials, error) {
+	key := u.Scheme + "://" + u.Host
+	if helper, ok := ch.Helper.(pathCredentialHelper); ok && helper.usesPath() {
+		key += u.Path
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if cached, ok := ch.cache[key]; ok && (cached.expiresAt.IsZero() || time.Now().Before(cached.expiresAt)) {
+		return cached.creds, nil
+	}
+
+	creds, err := ch.Helper.Credentials(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if ch.cache == nil {
+		ch.cache = make(map[string]cachedCredentials)
+	}
+
+	entry := cachedCredentials{creds: creds}
+	if ch.CacheTTL > 0 {
+		entry.expiresAt = time.Now().Add(ch.CacheTTL)
+	}
+
+	ch.cache[key] = entry
+
+	return creds, nil
+}
@@ -0,0 +1,209 @@
+package greq_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+// Respond with the basic auth credentials of the request
+func echoCredentials(w http.ResponseWriter, r *http.Request) {
+	username, password, _ := r.BasicAuth()
+	fmt.Fprintf(w, "%s:%s", username, password)
+}
+
+func TestNetrcAuth(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoCredentials))
+
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(netrc, []byte(`
+machine example.com login other password wrong
+
+macdef init
+machine 127.0.0.1 login macro password macro
+
+machine 127.0.0.1
+	login user
+	password pass
+
+default login anonymous password guest
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("NETRC", netrc)
+
+	resp, err := greq.GetRequest(server.URL).WithAuth(greq.NewNetrcAuth("")).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "user:pass" {
+		t.Errorf("expected user:pass, got %s", body)
+	}
+}
+
+func TestStaticCredentialHelperAuth(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoCredentials))
+
+	auth := greq.NewCredentialHelperAuth(greq.StaticCredentialHelper{
+		"127.0.0.1": {Username: "static", Password: "secret"},
+	})
+
+	resp, err := greq.GetRequest(server.URL).WithAuth(auth).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "static:secret" {
+		t.Errorf("expected static:secret, got %s", body)
+	}
+}
+
+// Not a real test, used as a fake credential helper by TestExecCredentialHelperAuth
+func TestCredentialHelperProcess(t *testing.T) {
+	if os.Getenv("GREQ_TEST_CREDENTIAL_HELPER") != "1" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	host := ""
+	for scanner.Scan() && scanner.Text() != "" {
+		if value, ok := strings.CutPrefix(scanner.Text(), "host="); ok {
+			host = value
+		} else if value, ok := strings.CutPrefix(scanner.Text(), "path="); ok {
+			host += "/" + value
+		}
+	}
+
+	// Count invocations to verify caching
+	if counter := os.Getenv("GREQ_TEST_CREDENTIAL_COUNTER"); counter != "" {
+		f, _ := os.OpenFile(counter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		f.WriteString("x")
+		f.Close()
+	}
+
+	fmt.Printf("username=helper\npassword=%s\n", host)
+	os.Exit(0)
+}
+
+func TestExecCredentialHelperAuth(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoCredentials))
+
+	counter := filepath.Join(t.TempDir(), "counter")
+
+	auth := greq.NewCredentialHelperAuth(&greq.ExecCredentialHelper{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestCredentialHelperProcess", "--"},
+		Env:     []string{"GREQ_TEST_CREDENTIAL_HELPER=1", "GREQ_TEST_CREDENTIAL_COUNTER=" + counter},
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := greq.GetRequest(server.URL).WithAuth(auth).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := resp.BodyString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "helper:" + strings.TrimPrefix(server.URL, "http://")
+		if body != expected {
+			t.Errorf("expected %s, got %s", expected, body)
+		}
+	}
+
+	calls, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 1 {
+		t.Errorf("expected the helper to be called once, got %d", len(calls))
+	}
+}
+
+func TestExecCredentialHelperPath(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoCredentials))
+
+	counter := filepath.Join(t.TempDir(), "counter")
+	helper := &greq.ExecCredentialHelper{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestCredentialHelperProcess", "--"},
+		Env:     []string{"GREQ_TEST_CREDENTIAL_HELPER=1", "GREQ_TEST_CREDENTIAL_COUNTER=" + counter},
+	}
+	auth := greq.NewCredentialHelperAuth(helper)
+
+	// The path is only sent when the helper opts in
+	resp, err := greq.GetRequest(server.URL + "/repo").WithAuth(auth).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	if body, _ := resp.BodyString(); body != "helper:"+host {
+		t.Errorf("expected no path, got %s", body)
+	}
+
+	helper.UseHTTPPath = true
+	auth = greq.NewCredentialHelperAuth(helper)
+
+	for _, path := range []string{"one", "two", "one"} {
+		resp, err := greq.GetRequest(server.URL + "/" + path).WithAuth(auth).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body, _ := resp.BodyString(); body != "helper:"+host+"/"+path {
+			t.Errorf("expected the path %s, got %s", path, body)
+		}
+	}
+
+	// The credentials are cached per path
+	if calls, _ := os.ReadFile(counter); len(calls) != 3 {
+		t.Errorf("expected the helper to be called 3 times, got %d", len(calls))
+	}
+}
+
+func TestExecCredentialHelperInjection(t *testing.T) {
+	helper := &greq.ExecCredentialHelper{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestCredentialHelperProcess", "--"},
+		Env:     []string{"GREQ_TEST_CREDENTIAL_HELPER=1"},
+	}
+
+	for _, rawURL := range []string{
+		"https://attacker.example/x%0Ahost=victim.example",
+		"https://attacker.example/x%0D%0Ahost=victim.example",
+		"https://attacker.example/x%00",
+	} {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if creds, err := helper.Credentials(u); err == nil {
+			t.Errorf("expected %s to be rejected, got %+v", rawURL, creds)
+		}
+	}
+}
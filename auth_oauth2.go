@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
 )
 
 type Oauth2AuthType string
@@ -113,16 +115,16 @@ func (oa *Oauth2Auth) Prepare() error {
 	}
 
 	if oa.AuthType == "" {
-		return fmt.Errorf("auth_type is required")
+		return errtools.MissingValueError("auth_type is required")
 	}
 
 	if oa.AuthType == ClientCredentials {
 		if oa.ClientID == "" || oa.ClientSecret == "" || (oa.DiscoveryUrl == "" && oa.TokenUrl == "") {
-			return fmt.Errorf("client_id, client_secret and discovery_url or authorization_url and token_url are required")
+			return errtools.MissingValueError("client_id, client_secret and discovery_url or authorization_url and token_url are required")
 		}
 
 		if oa.TokenUrl == "" {
-			metadata, err := GetRequest(oa.DiscoveryUrl).Execute()
+			metadata, err := GetRequest(oa.DiscoveryUrl).EnsureSuccess().Execute()
 			if err != nil {
 				return err
 			}
@@ -135,7 +137,7 @@ func (oa *Oauth2Auth) Prepare() error {
 			oa.AuthorizationUrl = oa.discovery.AuthorizationEndpoint
 
 			if !oa.discovery.IsGrantTypeSupported("client_credentials") {
-				return fmt.Errorf("client_credentials grant type is not supported by this provider")
+				return errtools.InvalidFieldError("client_credentials grant type is not supported by this provider")
 			}
 		}
 
@@ -182,16 +184,11 @@ func (oa *Oauth2Auth) Prepare() error {
 			request = request.WithUrlencodedFormBody(body, nil)
 		}
 
-		resp, err := request.Execute()
+		resp, err := request.WithExpectStatus(http.StatusOK).Execute()
 		if err != nil {
 			return err
 		}
 
-		if resp.StatusCode != 200 {
-			bodystr, _ := resp.BodyString()
-			return fmt.Errorf("unexpected status code: %d - %s", resp.StatusCode, bodystr)
-		}
-
 		if err := resp.BodyUnmarshalJson(&oa.token); err != nil {
 			return err
 		}
@@ -204,7 +201,7 @@ func (oa *Oauth2Auth) Prepare() error {
 	}
 
 	// TODO: Implement Rest
-	return fmt.Errorf("not implemented")
+	return errtools.InvalidFieldError(fmt.Sprintf("auth_type %s is not implemented", oa.AuthType))
 
 }
 
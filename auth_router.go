@@ -0,0 +1,111 @@
+package greq
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A route for the AuthRouter
+// The pattern is a host, optionally followed by a path prefix:
+// - api.example.com matches the host api.example.com on any port
+// - api.example.com:8443 matches only port 8443
+// - *.example.com matches all subdomains of example.com, but not example.com itself
+// - * matches all hosts
+// - api.example.com/v2 matches paths starting with /v2 on api.example.com
+type AuthRoute struct {
+	Pattern string
+	Auth    Authorization
+}
+
+// Picks the authorization to use based on the URL of the request
+// Routes are checked in order and the first matching route is used.
+// If no route matches, the default authorization is used, and if there
+// is no default no authorization is added.
+type AuthRouter struct {
+	Routes  []AuthRoute
+	Default Authorization
+}
+
+func NewAuthRouter() *AuthRouter {
+	return &AuthRouter{}
+}
+
+// Add a route to the router
+func (ar *AuthRouter) Route(pattern string, auth Authorization) *AuthRouter {
+	ar.Routes = append(ar.Routes, AuthRoute{Pattern: pattern, Auth: auth})
+	return ar
+}
+
+// Set the authorization used when no route matches
+func (ar *AuthRouter) WithDefault(auth Authorization) *AuthRouter {
+	ar.Default = auth
+	return ar
+}
+
+// The matching authorization is prepared when it is applied,
+// so credentials are only fetched for hosts that are requested
+func (ar *AuthRouter) Prepare() error {
+	return nil
+}
+
+func (ar *AuthRouter) Apply(addHeaderFunc func(key, value string), setTransportFunc func(transport http.RoundTripper)) error {
+	return fmt.Errorf("auth router needs the request url, use ApplyTarget")
+}
+
+func (ar *AuthRouter) ApplyTarget(target *AuthTarget) error {
+	if target.URL == nil {
+		return fmt.Errorf("auth router needs a valid request url")
+	}
+
+	auth := ar.Default
+
+	for _, route := range ar.Routes {
+		if matchAuthRoute(route.Pattern, target.URL) {
+			auth = route.Auth
+			break
+		}
+	}
+
+	if auth == nil {
+		return nil
+	}
+
+	if err := auth.Prepare(); err != nil {
+		return err
+	}
+
+	return applyAuth(auth, target)
+}
+
+// Check if a request URL matches a route pattern
+func matchAuthRoute(pattern string, u *url.URL) bool {
+	hostPattern, pathPrefix, hasPath := strings.Cut(pattern, "/")
+	if hasPath && pathPrefix != "" {
+		prefix := "/" + strings.TrimSuffix(pathPrefix, "/")
+		if u.Path != prefix && !strings.HasPrefix(u.Path, prefix+"/") {
+			return false
+		}
+	}
+
+	hostPattern = strings.ToLower(hostPattern)
+	if hostPattern == "*" {
+		return true
+	}
+
+	// Only compare the port if the pattern has one
+	host := strings.ToLower(u.Hostname())
+	if _, _, err := net.SplitHostPort(hostPattern); err == nil {
+		host = strings.ToLower(u.Host)
+	} else {
+		hostPattern = strings.Trim(hostPattern, "[]")
+	}
+
+	if strings.HasPrefix(hostPattern, "*.") {
+		return strings.HasSuffix(host, hostPattern[1:])
+	}
+
+	return host == hostPattern
+}
@@ -7,17 +7,218 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
-	"net/url"
+	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/scheiblingco/gofn/errtools"
-	"github.com/scheiblingco/gofn/typetools"
 )
 
+// A request body that can be opened again for redirects, retries and authentication rounds
+// A length of -1 means the length is unknown
+type requestBody struct {
+	open   func() (io.ReadCloser, error)
+	length int64
+
+	// Bodies from a plain reader can only be read once
+	oneShot bool
+
+	// The position of the fields in multipart bodies, for progress reporting
+	parts []bodyPart
+
+	// Called when the request is done with the body, to close the reader it is read from
+	release func()
+}
+
+func byteBody(body []byte) *requestBody {
+	return &requestBody{
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		},
+		length: int64(len(body)),
+	}
+}
+
+// Create a body from a reader
+// In-memory readers are snapshotted and seekable readers (like files) are rewound to their
+// current offset when the body is opened again. Other readers can only be sent once.
+// Readers that implement io.Closer are closed when the request is done with them.
+func readerBody(body io.Reader) *requestBody {
+	switch val := body.(type) {
+	case *bytes.Buffer:
+		return byteBody(val.Bytes())
+	case *bytes.Reader:
+		snapshot := *val
+		return &requestBody{
+			open: func() (io.ReadCloser, error) {
+				r := snapshot
+				return io.NopCloser(&r), nil
+			},
+			length: int64(val.Len()),
+		}
+	case *strings.Reader:
+		snapshot := *val
+		return &requestBody{
+			open: func() (io.ReadCloser, error) {
+				r := snapshot
+				return io.NopCloser(&r), nil
+			},
+			length: int64(val.Len()),
+		}
+	}
+
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			length := int64(-1)
+			if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				length = end - offset
+			}
+
+			shared := &sharedReader{reader: seeker}
+			shared.closer, _ = body.(io.Closer)
+
+			return &requestBody{
+				open: func() (io.ReadCloser, error) {
+					if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+						return nil, err
+					}
+
+					return shared.open(), nil
+				},
+				length:  length,
+				release: shared.finish,
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	used := false
+
+	return &requestBody{
+		open: func() (io.ReadCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if used {
+				return nil, errtools.BodyConsumedError("the request body is a reader that can only be sent once, use WithBodyFunc to send it again")
+			}
+
+			used = true
+
+			// The client closes the body after sending it, or when the request fails
+			if rc, ok := body.(io.ReadCloser); ok {
+				return rc, nil
+			}
+
+			return io.NopCloser(body), nil
+		},
+		length:  -1,
+		oneShot: true,
+		release: func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// A reader that was never sent is closed here instead
+			if closer, ok := body.(io.Closer); ok && !used {
+				used = true
+				closer.Close()
+			}
+		},
+	}
+}
+
+// Close the reader the body is read from, once every body opened from it is closed
+func (b *requestBody) done() {
+	if b != nil && b.release != nil {
+		b.release()
+	}
+}
+
+// A seekable reader that is opened once for every attempt of the request
+// It is closed when the request is done and the last opened body is closed.
+type sharedReader struct {
+	reader io.Reader
+	closer io.Closer
+
+	mu       sync.Mutex
+	opened   int
+	finished bool
+}
+
+func (s *sharedReader) open() io.ReadCloser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.opened++
+	return &sharedBody{shared: s}
+}
+
+func (s *sharedReader) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finished = true
+	s.closeIfDone()
+}
+
+// Close the reader, must be called with the lock held
+func (s *sharedReader) closeIfDone() {
+	if s.finished && s.opened == 0 && s.closer != nil {
+		s.closer.Close()
+		s.closer = nil
+	}
+}
+
+type sharedBody struct {
+	shared    *sharedReader
+	closeOnce sync.Once
+}
+
+func (b *sharedBody) Read(p []byte) (int, error) {
+	return b.shared.reader.Read(p)
+}
+
+func (b *sharedBody) Close() error {
+	b.closeOnce.Do(func() {
+		b.shared.mu.Lock()
+		defer b.shared.mu.Unlock()
+
+		b.shared.opened--
+		b.shared.closeIfDone()
+	})
+
+	return nil
+}
+
+// Set the body, content length and GetBody on the request
+func (b *requestBody) apply(req *http.Request) error {
+	if b == nil {
+		return nil
+	}
+
+	body, err := b.open()
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = b.length
+	req.Body = body
+
+	if b.length == 0 {
+		body.Close()
+		req.Body = http.NoBody
+	}
+
+	if !b.oneShot {
+		req.GetBody = b.open
+	}
+
+	return nil
+}
+
 // Add a body to the request in the form of a byte slice
 func (g *GRequest) WithByteBody(body []byte) *GRequest {
-	g.bodyAccepted()
-
-	g.body = bytes.NewReader(body)
+	g.body = byteBody(body)
 	return g
 }
 
@@ -27,10 +228,19 @@ func (g *GRequest) WithStringBody(body string) *GRequest {
 }
 
 // Add a body to the request in the form of a reader
+// Buffers, byte and string readers and seekable readers like files can be sent again on
+// redirects and authentication rounds, other readers can only be sent once.
+// The request takes ownership of readers that implement io.Closer, like files and pipes:
+// they are closed when Execute is done with them, also when the request fails.
 func (g *GRequest) WithReaderBody(body io.Reader) *GRequest {
-	g.bodyAccepted()
+	g.body = readerBody(body)
+	return g
+}
 
-	g.body = body
+// Add a body to the request that is opened by calling open, every time it needs to be sent
+// contentLength is the length of the body, or -1 if it is unknown
+func (g *GRequest) WithBodyFunc(open func() (io.ReadCloser, error), contentLength int64) *GRequest {
+	g.body = &requestBody{open: open, length: contentLength}
 	return g
 }
 
@@ -38,21 +248,19 @@ func (g *GRequest) WithReaderBody(body io.Reader) *GRequest {
 // Accepts an interface{} that will be marshalled into JSON, or
 // a string or string-like object with pre-marshalled JSON
 func (g *GRequest) WithJSONBody(body interface{}, contentType *string) *GRequest {
-	g.bodyAccepted()
-
 	cType := "application/json"
 	if contentType != nil {
 		cType = *contentType
 	}
 
-	g = g.WithHeader("Content-Type", cType)
+	g.setBodyHeader("Content-Type", cType)
 
 	if val, ok := body.(string); ok {
-		return g.WithStringBody(val).WithHeader("Content-Type", cType)
+		return g.WithStringBody(val)
 	}
 
 	if val, ok := body.([]byte); ok {
-		return g.WithByteBody(val).WithHeader("Content-Type", cType)
+		return g.WithByteBody(val)
 	}
 
 	buf := new(bytes.Buffer)
@@ -62,7 +270,7 @@ func (g *GRequest) WithJSONBody(body interface{}, contentType *string) *GRequest
 		g.addError(err)
 	}
 
-	g.body = buf
+	g.body = byteBody(buf.Bytes())
 
 	return g
 }
@@ -71,14 +279,12 @@ func (g *GRequest) WithJSONBody(body interface{}, contentType *string) *GRequest
 // Accepts an interface{} that will be marshalled into XML, or
 // a string or string-like object with pre-marshalled XML
 func (g *GRequest) WithXMLBody(body interface{}, contentType *string) *GRequest {
-	g.bodyAccepted()
-
 	cType := "application/xml"
 	if contentType != nil {
 		cType = *contentType
 	}
 
-	g = g.WithHeader("Content-Type", cType)
+	g.setBodyHeader("Content-Type", cType)
 
 	switch val := body.(type) {
 	case string:
@@ -97,87 +303,45 @@ func (g *GRequest) WithXMLBody(body interface{}, contentType *string) *GRequest
 		g.addError(err)
 	}
 
-	g.body = buf
+	g.body = byteBody(buf.Bytes())
 
 	return g
 }
 
 // Add a application/x-www-form-urlencoded body
-// Accepts the following types:
-// - map[string]string
-// - map[string][]string
-// - map[string][]byte
-// - map[string]interface{} where interface can be a string-like, numeric, string slice or boolean type
-// - url.Values
+// Accepts url.Values, a map with string keys or a struct with `form:"..."` tags,
+// encoded the same way as WithQueryParams, see Encoder.
 func (g *GRequest) WithUrlencodedFormBody(body interface{}, contentType *string) *GRequest {
-	g.bodyAccepted()
-
 	cType := "application/x-www-form-urlencoded"
 	if contentType != nil {
 		cType = *contentType
 	}
 
-	data := url.Values{}
+	g.setBodyHeader("Content-Type", cType)
 
-	switch val := body.(type) {
-	case url.Values:
-		return g.WithStringBody(val.Encode()).WithHeader("Content-Type", cType)
-	case map[string]string:
-		for k, v := range val {
-			data.Add(k, v)
-		}
-		return g.WithStringBody(data.Encode()).WithHeader("Content-Type", cType)
-	case map[string][]string:
-		for k, v := range val {
-			for _, v2 := range v {
-				data.Add(k, v2)
-			}
-		}
-		return g.WithStringBody(data.Encode()).WithHeader("Content-Type", cType)
-	case map[string][]byte:
-		for k, v := range val {
-			data.Add(k, string(v))
-		}
-		return g.WithStringBody(data.Encode()).WithHeader("Content-Type", cType)
-	case map[string]interface{}:
-		for k, v := range val {
-			if typetools.IsStringlikeType(v) || typetools.IsNumericType(v) {
-				data.Add(k, typetools.EnsureString(v))
-			} else {
-				if vt, ok := v.([]string); ok {
-					for _, v2 := range vt {
-						data.Add(k, v2)
-					}
-				} else if vt, ok := v.(bool); ok {
-					data.Add(k, fmt.Sprintf("%t", vt))
-				} else {
-					g.addError(errtools.InvalidTypeError(fmt.Sprintf("field %s - form value must be a string, string slice, or string-like type", k)))
-				}
-			}
-		}
-		return g.WithStringBody(data.Encode()).WithHeader("Content-Type", cType)
+	data, err := g.getEncoder().Encode(body, "form")
+	if err != nil {
+		g.addError(err)
+		return g
 	}
 
-	g.addError(errtools.InvalidTypeError("form body must be a map[string]string, map[string][]string, map[string][]byte, map[string]interface{}, or url.Values"))
-	return g
+	return g.WithStringBody(data.Encode())
 }
 
 // Add a multipart form body to the request
 // Accepts a list of multipart fields
 func (g *GRequest) WithMultipartFormBody(body []*MultipartField) *GRequest {
-	g.bodyAccepted()
-
-	if g.headers == nil {
-		g.headers = make(map[string]string)
-	}
-
 	buf := &bytes.Buffer{}
 	writer := multipart.NewWriter(buf)
+	parts := make([]bodyPart, 0, len(body))
 
 	for _, field := range body {
-		if err := field.AddToWriter(writer); err != nil {
+		n, err := field.copyToWriter(writer)
+		if err != nil {
 			g.addError(err)
 		}
+
+		parts = append(parts, bodyPart{name: field.Key, start: int64(buf.Len()) - n, length: n})
 	}
 
 	if len(g.errs) > 0 {
@@ -189,9 +353,140 @@ func (g *GRequest) WithMultipartFormBody(body []*MultipartField) *GRequest {
 		return g
 	}
 
-	g.body = buf
+	g.body = byteBody(buf.Bytes())
+	g.body.parts = parts
+	g.setBodyHeader("Content-Type", writer.FormDataContentType())
+
+	return g
+}
+
+// Add a multipart form body that is streamed while the request is sent, instead of being
+// buffered in memory. Use this for large files.
+//
+// The Content-Length is set when the size of every field is known (strings, bytes, files
+// and other seekable readers), otherwise the body is sent with chunked encoding.
+// Errors reading a field are returned from Execute. Readers that implement io.Closer, like
+// files and pipes, are closed when Execute is done with them, also when the request fails.
+func (g *GRequest) WithStreamingMultipartFormBody(body []*MultipartField) *GRequest {
+	parts := make([]*requestBody, 0, len(body))
+	oneShot := false
+
+	for _, field := range body {
+		if field.value == nil {
+			g.addError(errtools.MissingValueError(fmt.Sprintf("multipart field %s has no value", field.Key)))
+			return g
+		}
+
+		part := readerBody(field.value)
+		oneShot = oneShot || part.oneShot
+		parts = append(parts, part)
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	length, positions, err := multipartLength(body, parts, boundary)
+	if err != nil {
+		g.addError(err)
+		return g
+	}
+
+	g.body = &requestBody{
+		open: func() (io.ReadCloser, error) {
+			pr, pw := io.Pipe()
+
+			go func() {
+				pw.CloseWithError(writeMultipart(pw, body, parts, boundary))
+			}()
+
+			return pr, nil
+		},
+		length:  length,
+		oneShot: oneShot,
+		parts:   positions,
+		release: func() {
+			for _, part := range parts {
+				part.done()
+			}
+		},
+	}
+
+	g.setBodyHeader("Content-Type", "multipart/form-data; boundary="+boundary)
+
+	return g
+}
+
+// Write the multipart fields to w, opening the body of each field
+func writeMultipart(w io.Writer, fields []*MultipartField, parts []*requestBody, boundary string) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for i, field := range fields {
+		fw, err := field.createPart(writer)
+		if err != nil {
+			return err
+		}
+
+		value, err := parts[i].open()
+		if err != nil {
+			return fmt.Errorf("multipart field %s: %w", field.Key, err)
+		}
+
+		_, err = io.Copy(fw, value)
+		value.Close()
+
+		if err != nil {
+			return fmt.Errorf("multipart field %s: %w", field.Key, err)
+		}
+	}
+
+	return writer.Close()
+}
+
+// Calculate the length of a multipart body and the position of each field,
+// by writing the part headers without their content.
+// Returns a length of -1 if the length of any field is unknown, the positions
+// are calculated up to and including the first field with an unknown length.
+func multipartLength(fields []*MultipartField, parts []*requestBody, boundary string) (int64, []bodyPart, error) {
+	counter := &countingWriter{}
+
+	writer := multipart.NewWriter(counter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return 0, nil, err
+	}
+
+	length := int64(0)
+	positions := make([]bodyPart, 0, len(fields))
+
+	for i, field := range fields {
+		if _, err := field.createPart(writer); err != nil {
+			return 0, nil, err
+		}
+
+		positions = append(positions, bodyPart{name: field.Key, start: counter.n + length, length: parts[i].length})
+
+		if parts[i].length < 0 {
+			return -1, positions, nil
+		}
+
+		length += parts[i].length
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, nil, err
+	}
+
+	return length + counter.n, positions, nil
+}
+
+type countingWriter struct {
+	n int64
+}
 
-	return g.WithHeader("Content-Type", writer.FormDataContentType())
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
 }
 
 // TODO: Add support for GraphQL Request
@@ -0,0 +1,359 @@
+package greq_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+// Redirects /redirect to /final with a 307, which resends the body, and echoes
+// the body and content length from /final
+func echoRedirectedBody(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/redirect" {
+		http.Redirect(w, r, "/final", http.StatusTemporaryRedirect)
+		return
+	}
+
+	w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	io.Copy(w, r.Body)
+}
+
+func TestReplayableBodies(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoRedirectedBody))
+
+	file := filepath.Join(t.TempDir(), "body.txt")
+	if err := os.WriteFile(file, []byte("skip:file body"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Start reading the file after the prefix, the offset is kept when rewinding
+	f.Seek(5, io.SeekStart)
+
+	tests := map[string]*greq.GRequest{
+		"bytes":  greq.PostRequest(server.URL + "/redirect").WithByteBody([]byte("bytes body")),
+		"string": greq.PostRequest(server.URL + "/redirect").WithStringBody("string body"),
+		"reader": greq.PostRequest(server.URL + "/redirect").WithReaderBody(strings.NewReader("reader body")),
+		"buffer": greq.PostRequest(server.URL + "/redirect").WithReaderBody(bytes.NewBufferString("buffer body")),
+		"json":   greq.PostRequest(server.URL+"/redirect").WithJSONBody(map[string]string{"json": "body"}, nil),
+		"func": greq.PostRequest(server.URL+"/redirect").WithBodyFunc(func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("func body")), nil
+		}, 9),
+	}
+
+	expected := map[string]string{
+		"bytes":  "bytes body",
+		"string": "string body",
+		"reader": "reader body",
+		"buffer": "buffer body",
+		"json":   "{\"json\":\"body\"}\n",
+		"func":   "func body",
+	}
+
+	for name, request := range tests {
+		// Execute twice to check the body can be sent again
+		for i := 0; i < 2; i++ {
+			resp, err := request.Execute()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			body, err := resp.BodyString()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != http.StatusOK || body != expected[name] {
+				t.Errorf("%s: unexpected response %d %q", name, resp.StatusCode, body)
+			}
+
+			if length := resp.Response.Header.Get("X-Content-Length"); length != strconv.Itoa(len(expected[name])) {
+				t.Errorf("%s: unexpected content length %s", name, length)
+			}
+		}
+	}
+
+	// Files are sent again on the redirect, and closed when the request is done
+	resp, err := greq.PostRequest(server.URL + "/redirect").WithReaderBody(f).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyString(); resp.StatusCode != http.StatusOK || body != "file body" {
+		t.Errorf("file: unexpected response %d %q", resp.StatusCode, body)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the file to be closed, got %v", err)
+	}
+}
+
+func TestOneShotBody(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoRedirectedBody))
+
+	request := greq.PostRequest(server.URL + "/final").WithReaderBody(io.MultiReader(strings.NewReader("once")))
+
+	resp, err := request.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyString(); body != "once" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	if _, err := request.Execute(); err == nil {
+		t.Error("expected an error sending a one-shot body twice")
+	}
+
+	// Redirects that need the body are not followed without GetBody
+	resp, err = greq.PostRequest(server.URL + "/redirect").WithReaderBody(io.MultiReader(strings.NewReader("once"))).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected the redirect to be returned, got %d", resp.StatusCode)
+	}
+}
+
+type closeTracker struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// Write to the pipe until it fails, returning the error
+func writeUntilClosed(pw *io.PipeWriter) <-chan error {
+	result := make(chan error, 1)
+
+	go func() {
+		chunk := make([]byte, 32<<10)
+		for {
+			if _, err := pw.Write(chunk); err != nil {
+				result <- err
+				return
+			}
+		}
+	}()
+
+	return result
+}
+
+func TestReaderBodyClosed(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoRedirectedBody))
+
+	body := &closeTracker{Reader: io.MultiReader(strings.NewReader("closed"))}
+
+	resp, err := greq.PostRequest(server.URL + "/final").WithReaderBody(body).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if !body.closed.Load() {
+		t.Error("expected the body to be closed after the request")
+	}
+
+	// A failed request closes the pipe, so the writer does not block forever
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	pr, pw := io.Pipe()
+	written := writeUntilClosed(pw)
+
+	if _, err := greq.PostRequest("http://" + listener.Addr().String()).WithReaderBody(pr).Execute(); err == nil {
+		t.Fatal("expected the connection to be refused")
+	}
+
+	select {
+	case err := <-written:
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("expected a closed pipe, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pipe was not closed after the request failed")
+	}
+}
+
+type failingReader struct{}
+
+var errFieldRead = errors.New("field read failed")
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errFieldRead
+}
+
+func TestStreamingMultipart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/final", http.StatusTemporaryRedirect)
+			return
+		}
+
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		content, _ := io.ReadAll(file)
+
+		w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Write([]byte(r.FormValue("name") + ":" + string(content)))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "upload.txt")
+	if err := os.WriteFile(path, []byte("file content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// The body is sent again after the redirect
+	resp, err := greq.PostRequest(server.URL + "/redirect").WithStreamingMultipartFormBody([]*greq.MultipartField{
+		greq.NewMultipartField("name").WithStringValue("greq"),
+		greq.NewMultipartField("file").WithFile(file, nil),
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := resp.BodyString()
+	if resp.StatusCode != http.StatusOK || body != "greq:file content" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+
+	if resp.Response.Header.Get("X-Content-Length") == "-1" {
+		t.Error("expected a known content length")
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the file to be closed, got %v", err)
+	}
+
+	// The length of a plain reader is unknown, so the body is chunked
+	resp, err = greq.PostRequest(server.URL).WithStreamingMultipartFormBody([]*greq.MultipartField{
+		greq.NewMultipartField("file").WithFilename("stream.txt").WithReaderValue(io.MultiReader(strings.NewReader("streamed"))),
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyString(); body != ":streamed" || resp.Response.Header.Get("X-Content-Length") != "-1" {
+		t.Errorf("unexpected chunked response %q %s", body, resp.Response.Header.Get("X-Content-Length"))
+	}
+
+	_, err = greq.PostRequest(server.URL).WithStreamingMultipartFormBody([]*greq.MultipartField{
+		greq.NewMultipartField("file").WithFilename("fail.txt").WithReaderValue(failingReader{}),
+	}).Execute()
+	if !errors.Is(err, errFieldRead) {
+		t.Errorf("expected the field error, got %v", err)
+	}
+
+	err = greq.PostRequest(server.URL).WithStreamingMultipartFormBody([]*greq.MultipartField{
+		greq.NewMultipartField("empty"),
+	}).Validate()
+	if err == nil {
+		t.Error("expected an error for a field without a value")
+	}
+}
+
+func TestStreamingMultipartClosesFields(t *testing.T) {
+	// Reject the upload without reading it
+	server := newTestServer(t, respond(http.StatusRequestEntityTooLarge, "", "too large"))
+
+	path := filepath.Join(t.TempDir(), "upload.txt")
+	if err := os.WriteFile(path, []byte("file content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	written := writeUntilClosed(pw)
+
+	resp, err := greq.PostRequest(server.URL).WithStreamingMultipartFormBody([]*greq.MultipartField{
+		greq.NewMultipartField("stream").WithFilename("stream.bin").WithPipe(pr),
+		greq.NewMultipartField("file").WithFile(file, nil),
+	}).Execute()
+	if err == nil {
+		resp.Close()
+	}
+
+	select {
+	case err := <-written:
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("expected a closed pipe, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pipe field was not closed after the upload was rejected")
+	}
+
+	// The file field was never sent, it is closed when the request is done
+	if _, err := file.Seek(0, io.SeekStart); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the file to be closed, got %v", err)
+	}
+}
+
+func TestStreamingMultipartFailedExecute(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		// The TLS options are invalid, so the request fails before it is sent
+		_, err := greq.PostRequest("https://localhost").
+			WithTLSConfig(greq.TLSOptions{MinVersion: tls.VersionTLS13, MaxVersion: tls.VersionTLS12}).
+			WithStreamingMultipartFormBody([]*greq.MultipartField{
+				greq.NewMultipartField("file").WithFilename("stream.txt").WithReaderValue(io.MultiReader(strings.NewReader("streamed"))),
+			}).
+			Execute()
+		if err == nil {
+			t.Fatal("expected an error for the invalid TLS options")
+		}
+	}
+
+	if after := settledGoroutines(before); after > before {
+		t.Errorf("expected the body goroutines to exit, %d goroutines before and %d after", before, after)
+	}
+}
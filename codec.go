@@ -0,0 +1,310 @@
+package greq
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/net/html/charset"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Decodes a body into v
+type DecodeFunc func(data []byte, v interface{}) error
+
+// Encodes request bodies with WithBody
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	// The media type of the encoded body, used as the Content-Type header
+	ContentType() string
+}
+
+// A codec that can also decode, it is registered as the decoder for its content type
+type CodecUnmarshaler interface {
+	Codec
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	registryMu sync.RWMutex
+	decoders   = map[string]DecodeFunc{}
+	codecs     = map[string]Codec{}
+)
+
+// Register a codec for its content type, making it available through LookupCodec
+// If the codec implements CodecUnmarshaler, it is also registered as the decoder used
+// by GResponse.Unmarshal for the content type
+func RegisterCodec(codec Codec) {
+	mediaType := strings.ToLower(codec.ContentType())
+
+	registryMu.Lock()
+	codecs[mediaType] = codec
+	registryMu.Unlock()
+
+	if unmarshaler, ok := codec.(CodecUnmarshaler); ok {
+		RegisterDecoder(mediaType, unmarshaler.Unmarshal)
+	}
+}
+
+// Find the registered codec for a media type
+func LookupCodec(mediaType string) (Codec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	codec, ok := codecs[strings.ToLower(mediaType)]
+	return codec, ok
+}
+
+// Register a decoder for a media type, for example application/vnd.custom, used by GResponse.Unmarshal
+// Registering a media type that already has a decoder replaces it
+func RegisterDecoder(mediaType string, decode DecodeFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	decoders[strings.ToLower(mediaType)] = decode
+}
+
+func init() {
+	for _, codec := range []Codec{JSONCodec, XMLCodec, YAMLCodec, MsgPackCodec, CBORCodec, ProtobufCodec, NDJSONCodec} {
+		RegisterCodec(codec)
+	}
+
+	// Other media types in use for the same formats
+	RegisterDecoder("text/json", JSONCodec.Unmarshal)
+	RegisterDecoder("text/xml", XMLCodec.Unmarshal)
+	RegisterDecoder("application/x-msgpack", MsgPackCodec.Unmarshal)
+	RegisterDecoder("application/vnd.msgpack", MsgPackCodec.Unmarshal)
+	RegisterDecoder("application/protobuf", ProtobufCodec.Unmarshal)
+	RegisterDecoder("application/jsonl", NDJSONCodec.Unmarshal)
+
+	for _, mediaType := range []string{"application/x-yaml", "text/yaml", "text/x-yaml"} {
+		RegisterDecoder(mediaType, YAMLCodec.Unmarshal)
+	}
+
+	RegisterDecoder("application/x-www-form-urlencoded", decodeForm)
+}
+
+// Send the body encoded with the codec, setting the Content-Type to the content type of the codec
+// The built-in codecs are JSONCodec, XMLCodec, YAMLCodec, MsgPackCodec, CBORCodec, ProtobufCodec
+// and NDJSONCodec, other codecs can be registered with RegisterCodec and found with LookupCodec
+func (g *GRequest) WithBody(body interface{}, codec Codec) *GRequest {
+	if codec == nil {
+		g.addError(errtools.MissingValueError("codec cannot be nil"))
+		return g
+	}
+
+	data, err := codec.Marshal(body)
+	if err != nil {
+		g.addError(err)
+		return g
+	}
+
+	g.setBodyHeader("Content-Type", codec.ContentType())
+	g.body = byteBody(data)
+
+	return g
+}
+
+// A codec from a content type and marshal and unmarshal functions
+type funcCodec struct {
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+func (c *funcCodec) ContentType() string {
+	return c.contentType
+}
+
+func (c *funcCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.marshal(v)
+}
+
+func (c *funcCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.unmarshal(data, v)
+}
+
+var (
+	// application/json, using encoding/json
+	JSONCodec CodecUnmarshaler = &funcCodec{"application/json", json.Marshal, json.Unmarshal}
+	// application/xml, using encoding/xml
+	XMLCodec CodecUnmarshaler = &funcCodec{"application/xml", xml.Marshal, decodeXML}
+	// application/yaml, using gopkg.in/yaml.v3
+	YAMLCodec CodecUnmarshaler = &funcCodec{"application/yaml", yaml.Marshal, yaml.Unmarshal}
+	// application/msgpack, using github.com/vmihailenco/msgpack
+	MsgPackCodec CodecUnmarshaler = &funcCodec{"application/msgpack", msgpack.Marshal, msgpack.Unmarshal}
+	// application/cbor, using github.com/fxamacker/cbor
+	CBORCodec CodecUnmarshaler = &funcCodec{"application/cbor", cbor.Marshal, cbor.Unmarshal}
+	// application/x-protobuf, the value must be a proto.Message
+	ProtobufCodec CodecUnmarshaler = &funcCodec{"application/x-protobuf", marshalProtobuf, unmarshalProtobuf}
+	// application/x-ndjson, newline delimited JSON
+	// The value must be a slice or array, each element is encoded on its own line.
+	// Decoding appends each line to the slice v points to.
+	NDJSONCodec CodecUnmarshaler = &funcCodec{"application/x-ndjson", marshalNDJSON, unmarshalNDJSON}
+)
+
+func marshalProtobuf(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, errtools.InvalidTypeError(fmt.Sprintf("protobuf body must be a proto.Message, got %T", v))
+	}
+
+	return proto.Marshal(message)
+}
+
+func unmarshalProtobuf(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return errtools.InvalidTypeError(fmt.Sprintf("protobuf target must be a proto.Message, got %T", v))
+	}
+
+	return proto.Unmarshal(data, message)
+}
+
+func marshalNDJSON(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, errtools.InvalidTypeError(fmt.Sprintf("ndjson body must be a slice or array, got %T", v))
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := encoder.Encode(rv.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func unmarshalNDJSON(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Slice {
+		return errtools.InvalidTypeError(fmt.Sprintf("ndjson target must be a pointer to a slice, got %T", v))
+	}
+
+	slice := rv.Elem()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		if err := decoder.Decode(elem.Interface()); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+// Find the decoder for a media type
+// Structured syntax suffixes (application/problem+json) fall back to the decoder for
+// the suffix (application/json)
+func lookupDecoder(mediaType string) (DecodeFunc, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if decode, ok := decoders[mediaType]; ok {
+		return decode, true
+	}
+
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		decode, ok := decoders["application/"+mediaType[i+1:]]
+		return decode, ok
+	}
+
+	return nil, false
+}
+
+// Decode XML, using the encoding from the XML declaration if the data is not UTF-8
+func decodeXML(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if utf8.Valid(data) {
+			return input, nil
+		}
+
+		return charset.NewReaderLabel(label, input)
+	}
+
+	return decoder.Decode(v)
+}
+
+// Decode a urlencoded form, using the form tags of structs and bracket notation for nested values
+func decodeForm(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	return NewEncoder().Decode(values, v, "form")
+}
+
+// Decode the body into v, based on the Content-Type header of the response
+// JSON, XML, YAML, MessagePack, CBOR and urlencoded forms are supported, including
+// structured syntax suffixes like application/problem+json. Bodies with a charset other
+// than UTF-8 are converted to UTF-8 first. Use RegisterDecoder to add other media types.
+func (r *GResponse) Unmarshal(v interface{}) error {
+	decode, label, err := r.contentDecoder()
+	if err != nil {
+		return err
+	}
+
+	data, err := r.BodyBytes()
+	if err != nil {
+		return err
+	}
+
+	return decodeCharset(decode, label, data, v)
+}
+
+// Find the decoder and charset for the Content-Type of the response
+func (r *GResponse) contentDecoder() (DecodeFunc, string, error) {
+	contentType := r.Response.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil, "", errtools.MissingValueError("the response has no Content-Type")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, "", errtools.InvalidFieldError(fmt.Sprintf("invalid Content-Type %q: %s", contentType, err))
+	}
+
+	decode, ok := lookupDecoder(mediaType)
+	if !ok {
+		return nil, "", errtools.InvalidTypeError(fmt.Sprintf("no decoder registered for %s", mediaType))
+	}
+
+	return decode, strings.ToLower(params["charset"]), nil
+}
+
+// Decode data in the given charset, converting it to UTF-8 first
+func decodeCharset(decode DecodeFunc, label string, data []byte, v interface{}) error {
+	if label != "" && label != "utf-8" && label != "utf8" && label != "us-ascii" {
+		reader, err := charset.NewReaderLabel(label, bytes.NewReader(data))
+		if err != nil {
+			return errtools.InvalidFieldError(fmt.Sprintf("unsupported charset %q", label))
+		}
+
+		if data, err = io.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+
+	return decode(data, v)
+}
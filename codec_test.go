@@ -0,0 +1,213 @@
+package greq_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/clysec/greq"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type Pet struct {
+	Name string   `json:"name" xml:"name" yaml:"name" msgpack:"name" cbor:"name" form:"name"`
+	Tags []string `json:"tags" xml:"tag" yaml:"tags" msgpack:"tags" cbor:"tags" form:"tags"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	msgpackBody, _ := msgpack.Marshal(Pet{Name: "Rex", Tags: []string{"dog", "good"}})
+	cborBody, _ := cbor.Marshal(Pet{Name: "Rex", Tags: []string{"dog", "good"}})
+
+	server := newTestServer(t, routes{
+		"/json":    respond(http.StatusOK, "application/json; charset=utf-8", `{"name":"Rex","tags":["dog","good"]}`),
+		"/problem": respond(http.StatusOK, "application/problem+json", `{"name":"Rex","tags":["dog","good"]}`),
+		"/xml":     respond(http.StatusOK, "application/atom+xml", `<pet><name>Rex</name><tag>dog</tag><tag>good</tag></pet>`),
+		"/yaml":    respond(http.StatusOK, "application/yaml", "name: Rex\ntags: [dog, good]\n"),
+		"/msgpack": respond(http.StatusOK, "application/msgpack", string(msgpackBody)),
+		"/cbor":    respond(http.StatusOK, "application/cbor", string(cborBody)),
+		"/form":    respond(http.StatusOK, "application/x-www-form-urlencoded", "name=Rex&tags=dog&tags=good"),
+		"/custom":  respond(http.StatusOK, "application/vnd.pet", "Rex:dog,good"),
+	})
+
+	greq.RegisterDecoder("application/vnd.pet", func(data []byte, v interface{}) error {
+		name, tags, ok := strings.Cut(string(data), ":")
+		if !ok {
+			return errors.New("invalid pet")
+		}
+
+		pet := v.(*Pet)
+		pet.Name, pet.Tags = name, strings.Split(tags, ",")
+		return nil
+	})
+
+	for _, path := range []string{"/json", "/problem", "/xml", "/yaml", "/msgpack", "/cbor", "/form", "/custom"} {
+		resp, err := greq.GetRequest(server.URL + path).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pet := Pet{}
+		if err := resp.Unmarshal(&pet); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		if pet.Name != "Rex" || len(pet.Tags) != 2 || pet.Tags[1] != "good" {
+			t.Errorf("%s: unexpected pet %+v", path, pet)
+		}
+	}
+}
+
+func TestUnmarshalCharset(t *testing.T) {
+	server := newTestServer(t, routes{
+		// "Zoë" in ISO-8859-1
+		"/json":    respond(http.StatusOK, "application/json; charset=ISO-8859-1", "{\"name\":\"Zo\xeb\"}"),
+		"/xml":     respond(http.StatusOK, "text/xml", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><pet><name>Zo\xeb</name></pet>"),
+		"/unknown": respond(http.StatusOK, "application/octet-stream", "Zoë"),
+		"/invalid": respond(http.StatusOK, "application/json; charset=nope", "{}"),
+	})
+
+	for _, path := range []string{"/json", "/xml"} {
+		resp, err := greq.GetRequest(server.URL + path).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pet := Pet{}
+		if err := resp.Unmarshal(&pet); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		if pet.Name != "Zoë" {
+			t.Errorf("%s: unexpected name %q", path, pet.Name)
+		}
+	}
+
+	for _, path := range []string{"/unknown", "/invalid"} {
+		resp, err := greq.GetRequest(server.URL + path).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := resp.Unmarshal(&Pet{}); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestWithBodyCodecs(t *testing.T) {
+	// Echoes the body with the Content-Type of the request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+
+	pet := Pet{Name: "Rex", Tags: []string{"dog", "good"}}
+
+	for _, codec := range []greq.Codec{greq.JSONCodec, greq.XMLCodec, greq.YAMLCodec, greq.MsgPackCodec, greq.CBORCodec} {
+		resp, err := greq.PostRequest(server.URL).WithBody(pet, codec).Execute()
+		if err != nil {
+			t.Fatalf("%s: %v", codec.ContentType(), err)
+		}
+
+		if contentType := resp.Response.Header.Get("Content-Type"); contentType != codec.ContentType() {
+			t.Errorf("unexpected Content-Type %q", contentType)
+		}
+
+		decoded := Pet{}
+		if err := resp.Unmarshal(&decoded); err != nil {
+			t.Fatalf("%s: %v", codec.ContentType(), err)
+		}
+
+		if decoded.Name != pet.Name || len(decoded.Tags) != 2 {
+			t.Errorf("%s: unexpected pet %+v", codec.ContentType(), decoded)
+		}
+	}
+
+	resp, err := greq.PostRequest(server.URL).WithBody(wrapperspb.String("protobuf"), greq.ProtobufCodec).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &wrapperspb.StringValue{}
+	if err := resp.Unmarshal(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Value != "protobuf" {
+		t.Errorf("unexpected protobuf message %v", message)
+	}
+
+	resp, err = greq.PostRequest(server.URL).WithBody([]Pet{pet, {Name: "Tom"}}, greq.NDJSONCodec).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pets := []Pet{}
+	if err := resp.Unmarshal(&pets); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pets) != 2 || pets[1].Name != "Tom" {
+		t.Errorf("unexpected ndjson pets %+v", pets)
+	}
+
+	invalid := []*greq.GRequest{
+		greq.PostRequest(server.URL).WithBody(pet, nil),
+		greq.PostRequest(server.URL).WithBody(pet, greq.ProtobufCodec),
+		greq.PostRequest(server.URL).WithBody(pet, greq.NDJSONCodec),
+	}
+
+	for _, request := range invalid {
+		if err := request.Validate(); err == nil {
+			t.Error("expected an error")
+		}
+	}
+}
+
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string { return "text/csv" }
+
+func (csvCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.Join(v.([]string), ",")), nil
+}
+
+func (csvCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]string)) = strings.Split(string(data), ",")
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	greq.RegisterCodec(csvCodec{})
+
+	codec, ok := greq.LookupCodec("text/csv")
+	if !ok {
+		t.Fatal("expected the codec to be registered")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type")+"; charset=utf-8")
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+
+	resp, err := greq.PostRequest(server.URL).WithBody([]string{"a", "b"}, codec).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := []string{}
+	if err := resp.Unmarshal(&values); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 2 || values[1] != "b" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
@@ -0,0 +1,216 @@
+package greq
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// A content coding for request and response bodies
+type Compression string
+
+const (
+	CompressionGzip    Compression = "gzip"
+	CompressionDeflate Compression = "deflate"
+	CompressionZstd    Compression = "zstd"
+	CompressionBrotli  Compression = "br"
+)
+
+// Encoders for each supported content coding
+// Deflate is the zlib format, as specified for HTTP in RFC 9110
+var compressionWriters = map[Compression]func(w io.Writer) (io.WriteCloser, error){
+	CompressionGzip: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	CompressionDeflate: func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	},
+	CompressionZstd: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+	CompressionBrotli: func(w io.Writer) (io.WriteCloser, error) {
+		return brotli.NewWriter(w), nil
+	},
+}
+
+// Decoders for each supported content coding
+var compressionReaders = map[Compression]func(r io.Reader) (io.ReadCloser, error){
+	CompressionGzip: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	CompressionDeflate: func(r io.Reader) (io.ReadCloser, error) {
+		// Some servers send raw deflate data instead of the zlib format
+		br := bufio.NewReader(r)
+		if header, err := br.Peek(2); err == nil && !isZlibHeader(header) {
+			return flate.NewReader(br), nil
+		}
+
+		return zlib.NewReader(br)
+	},
+	CompressionZstd: func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	},
+	CompressionBrotli: func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+}
+
+// Content codings that are decoded as one of the supported codings
+// x-gzip should be treated as gzip according to RFC 9110
+var compressionAliases = map[string]Compression{
+	"x-gzip": CompressionGzip,
+}
+
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// Decode a body with the content codings from a Content-Encoding header, in the reverse
+// order they were applied. Closing the returned reader closes the decoders and the body.
+// The body is returned as it is if any of the codings is not supported, since servers
+// sometimes send values like "UTF-8" that are not content codings at all.
+func decodeContent(body io.ReadCloser, contentEncoding string) (io.ReadCloser, error) {
+	var codings []string
+	for _, coding := range strings.Split(contentEncoding, ",") {
+		if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+
+	readers := make([]func(r io.Reader) (io.ReadCloser, error), 0, len(codings))
+	for _, coding := range codings {
+		if alias, ok := compressionAliases[coding]; ok {
+			coding = string(alias)
+		}
+
+		newReader, ok := compressionReaders[Compression(coding)]
+		if !ok {
+			return body, nil
+		}
+
+		readers = append(readers, newReader)
+	}
+
+	if len(readers) == 0 {
+		return body, nil
+	}
+
+	// An empty body, for example in a HEAD response, is not valid compressed data
+	buffered := bufio.NewReader(body)
+	if _, err := buffered.Peek(1); err == io.EOF {
+		return body, nil
+	}
+
+	decoded := &decodedBody{Reader: buffered, closers: []io.Closer{body}}
+
+	for i := len(readers) - 1; i >= 0; i-- {
+		reader, err := readers[i](decoded.Reader)
+		if err != nil {
+			decoded.Close()
+			return nil, err
+		}
+
+		decoded.Reader = reader
+		decoded.closers = append(decoded.closers, reader)
+	}
+
+	return decoded, nil
+}
+
+// A decoded body, closing the decoders and the original body
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if cerr := d.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Compress the request body with the given content coding and set the Content-Encoding header
+// The body is compressed while it is sent, so the request uses chunked encoding.
+// Use WithCompressionThreshold to only compress bodies above a certain size.
+func (g *GRequest) WithCompression(compression Compression) *GRequest {
+	if _, ok := compressionWriters[compression]; !ok {
+		g.addError(errtools.InvalidFieldError(fmt.Sprintf("unsupported compression %q", compression)))
+		return g
+	}
+
+	g.compression = compression
+	return g
+}
+
+// Only compress bodies of at least minSize bytes
+// Bodies with an unknown length are always compressed
+func (g *GRequest) WithCompressionThreshold(minSize int64) *GRequest {
+	g.compressionThreshold = minSize
+	return g
+}
+
+// Whether the body should be compressed
+func (g *GRequest) compressBody(body *requestBody) bool {
+	if g.compression == "" || body == nil || body.length == 0 {
+		return false
+	}
+
+	return body.length < 0 || body.length >= g.compressionThreshold
+}
+
+// Wrap the body so it is compressed every time it is opened
+func (b *requestBody) withCompression(compression Compression) *requestBody {
+	newWriter := compressionWriters[compression]
+
+	wrapped := *b
+	wrapped.length = -1
+	wrapped.parts = nil
+	wrapped.open = func() (io.ReadCloser, error) {
+		body, err := b.open()
+		if err != nil {
+			return nil, err
+		}
+
+		pr, pw := io.Pipe()
+
+		go func() {
+			defer body.Close()
+
+			w, err := newWriter(pw)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			if _, err := io.Copy(w, body); err != nil {
+				w.Close()
+				pw.CloseWithError(err)
+				return
+			}
+
+			pw.CloseWithError(w.Close())
+		}()
+
+		return pr, nil
+	}
+
+	return &wrapped
+}
@@ -0,0 +1,262 @@
+package greq_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/clysec/greq"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decompresses the request body based on Content-Encoding and echoes it,
+// with the encoding that was used in the X-Content-Encoding header
+func echoDecompressedBody(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/redirect" {
+		http.Redirect(w, r, "/final", http.StatusPermanentRedirect)
+		return
+	}
+
+	var body io.Reader = r.Body
+	var err error
+
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		body, err = gzip.NewReader(r.Body)
+	case "deflate":
+		body, err = zlib.NewReader(r.Body)
+	case "zstd":
+		body, err = zstd.NewReader(r.Body)
+	case "br":
+		body = brotli.NewReader(r.Body)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+	io.Copy(w, body)
+}
+
+func TestRequestCompression(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoDecompressedBody))
+
+	payload := map[string]string{"message": strings.Repeat("compress me ", 100)}
+
+	compressions := []greq.Compression{greq.CompressionGzip, greq.CompressionDeflate, greq.CompressionZstd, greq.CompressionBrotli}
+
+	for _, compression := range compressions {
+		resp, err := greq.PostRequest(server.URL+"/redirect").
+			WithJSONBody(payload, nil).
+			WithCompression(compression).
+			Execute()
+		if err != nil {
+			t.Fatalf("%s: %v", compression, err)
+		}
+
+		echoed := map[string]string{}
+		if err := resp.BodyUnmarshalJson(&echoed); err != nil {
+			t.Fatalf("%s: %v", compression, err)
+		}
+
+		if echoed["message"] != payload["message"] {
+			t.Errorf("%s: unexpected body %v", compression, echoed)
+		}
+
+		if encoding := resp.Response.Header.Get("X-Content-Encoding"); encoding != string(compression) {
+			t.Errorf("%s: unexpected Content-Encoding %q", compression, encoding)
+		}
+	}
+
+	// Bodies below the threshold are sent as they are
+	resp, err := greq.PostRequest(server.URL).
+		WithStringBody("small").
+		WithCompression(greq.CompressionGzip).
+		WithCompressionThreshold(1024).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyString(); body != "small" || resp.Response.Header.Get("X-Content-Encoding") != "" {
+		t.Errorf("expected an uncompressed body, got %q %q", body, resp.Response.Header.Get("X-Content-Encoding"))
+	}
+
+	if err := greq.PostRequest(server.URL).WithStringBody("x").WithCompression("lzma").Validate(); err == nil {
+		t.Error("expected an error for an unsupported compression")
+	}
+}
+
+func TestRequestCompressionFailedExecute(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		// The TLS options are invalid, so the request fails before the compressed body is read
+		_, err := greq.PostRequest("https://localhost").
+			WithTLSConfig(greq.TLSOptions{MinVersion: tls.VersionTLS13, MaxVersion: tls.VersionTLS12}).
+			WithStringBody(strings.Repeat("compress me ", 100)).
+			WithCompression(greq.CompressionGzip).
+			Execute()
+		if err == nil {
+			t.Fatal("expected an error for the invalid TLS options")
+		}
+	}
+
+	if after := settledGoroutines(before); after > before {
+		t.Errorf("expected the compression goroutines to exit, %d goroutines before and %d after", before, after)
+	}
+}
+
+// Compresses the response with the encoding from the enc query parameter, and echoes
+// the Accept-Encoding header of the request in X-Accept-Encoding
+func compressingHandler(t *testing.T, payload string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+
+		var buf bytes.Buffer
+		var cw io.WriteCloser
+
+		encoding := r.URL.Query().Get("enc")
+		switch encoding {
+		case "gzip", "x-gzip":
+			cw = gzip.NewWriter(&buf)
+		case "deflate":
+			cw = zlib.NewWriter(&buf)
+		case "rawdeflate":
+			cw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+			encoding = "deflate"
+		case "zstd":
+			cw, _ = zstd.NewWriter(&buf)
+		case "br":
+			cw = brotli.NewWriter(&buf)
+		case "gzip, br":
+			br := brotli.NewWriter(&buf)
+			cw = &stackedWriter{inner: br, outer: gzip.NewWriter(br)}
+		}
+
+		if cw == nil {
+			buf.WriteString(payload)
+		} else {
+			if _, err := io.WriteString(cw, payload); err != nil {
+				t.Error(err)
+			}
+			cw.Close()
+			w.Header().Set("Content-Encoding", encoding)
+		}
+
+		if r.Method != http.MethodHead {
+			w.Write(buf.Bytes())
+		}
+	}
+}
+
+// gzip, br means gzip was applied first, then brotli
+type stackedWriter struct {
+	inner io.WriteCloser
+	outer io.WriteCloser
+}
+
+func (s *stackedWriter) Write(p []byte) (int, error) {
+	return s.outer.Write(p)
+}
+
+func (s *stackedWriter) Close() error {
+	s.outer.Close()
+	return s.inner.Close()
+}
+
+func TestResponseDecompression(t *testing.T) {
+	payload := strings.Repeat("decompress me ", 100)
+
+	server := newTestServer(t, compressingHandler(t, payload))
+
+	for _, encoding := range []string{"", "gzip", "x-gzip", "deflate", "rawdeflate", "zstd", "br", "gzip, br"} {
+		resp, err := greq.GetRequest(server.URL).WithQueryParam("enc", encoding).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := resp.BodyString()
+		if err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+
+		if body != payload {
+			t.Errorf("%q: unexpected body %q", encoding, body)
+		}
+
+		if accept := resp.Response.Header.Get("X-Accept-Encoding"); accept != "gzip, deflate, br, zstd" {
+			t.Errorf("unexpected Accept-Encoding %q", accept)
+		}
+	}
+
+	// Setting Accept-Encoding manually does not disable decompression
+	resp, err := greq.GetRequest(server.URL).WithQueryParam("enc", "gzip").WithHeader("Accept-Encoding", "gzip").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := resp.BodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(*reader)
+	(*reader).Close()
+
+	if string(body) != payload {
+		t.Errorf("unexpected body from reader %q", body)
+	}
+
+	resp, err = greq.GetRequest(server.URL).WithQueryParam("enc", "gzip").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := resp.BodyRawBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(raw) < 2 || raw[0] != 0x1f || raw[1] != 0x8b {
+		t.Errorf("expected the raw gzip body, got %q", raw)
+	}
+
+	resp, err = greq.HeadRequest(server.URL).WithQueryParam("enc", "br").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, err := resp.BodyBytes(); err != nil || len(body) != 0 {
+		t.Errorf("expected an empty HEAD body, got %q %v", body, err)
+	}
+}
+
+func TestResponseUnknownEncoding(t *testing.T) {
+	// A charset instead of a content coding is a common misconfiguration
+	server := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", r.URL.Query().Get("enc"))
+		w.Write([]byte("hello"))
+	}))
+
+	for _, encoding := range []string{"UTF-8", "gzip, compress"} {
+		resp, err := greq.GetRequest(server.URL).WithQueryParam("enc", encoding).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body, err := resp.BodyString(); err != nil || body != "hello" {
+			t.Errorf("%q: expected the raw body, got %q %v", encoding, body, err)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package greq
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// A node in the tree of values parsed from bracket notation keys
+// Leaves hold the values for a key, branches hold the children by name or index
+type valueNode struct {
+	values   []string
+	children map[string]*valueNode
+}
+
+func (n *valueNode) child(key string) *valueNode {
+	if n.children == nil {
+		n.children = make(map[string]*valueNode)
+	}
+
+	c, ok := n.children[key]
+	if !ok {
+		c = &valueNode{}
+		n.children[key] = c
+	}
+
+	return c
+}
+
+// Split a bracket notation key into its parts: items[0][id] becomes items, 0, id
+// Empty brackets (tags[]) are dropped, as repeated values are already collected in a list
+func splitKey(key string) []string {
+	open := strings.IndexByte(key, '[')
+	if open <= 0 || !strings.HasSuffix(key, "]") {
+		return []string{key}
+	}
+
+	parts := []string{key[:open]}
+	for _, part := range strings.Split(key[open+1:len(key)-1], "][") {
+		if strings.ContainsAny(part, "[]") {
+			return []string{key}
+		}
+
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+// Decode url.Values into a struct, a map or an interface{}, reversing Encode
+// Bracket notation keys (filter[status], items[0][id], tags[]) are decoded into nested
+// structs, maps and slices. Struct fields are matched using the tag and the same options as Encode,
+// so a comma field is split and times are parsed with the layout tag.
+// When decoding into an interface{}, nested values become map[string]interface{} and []interface{},
+// and leaves become a string, or a []string if the key is repeated.
+func (e *Encoder) Decode(values url.Values, v interface{}, tag string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errtools.InvalidTypeError("decode target must be a non-nil pointer")
+	}
+
+	if target, ok := v.(*url.Values); ok {
+		*target = url.Values{}
+		for k, v := range values {
+			(*target)[k] = append((*target)[k], v...)
+		}
+
+		return nil
+	}
+
+	root := &valueNode{}
+	for key, vals := range values {
+		node := root
+		for _, part := range splitKey(key) {
+			node = node.child(part)
+		}
+
+		node.values = append(node.values, vals...)
+	}
+
+	return e.decodeValue(rv.Elem(), "", root, e.defaultOptions(tag))
+}
+
+// Decode a node into a value
+func (e *Encoder) decodeValue(rv reflect.Value, key string, node *valueNode, opts fieldOptions) error {
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+
+		return e.decodeValue(rv.Elem(), key, node, opts)
+	}
+
+	if rv.Kind() == reflect.Interface && rv.NumMethod() == 0 {
+		rv.Set(reflect.ValueOf(node.generic()))
+		return nil
+	}
+
+	if isScalarType(rv.Type()) {
+		if len(node.values) == 0 {
+			if node.children != nil {
+				return errtools.InvalidTypeError(fmt.Sprintf("field %s - cannot decode nested value into %s", key, rv.Type()))
+			}
+
+			return nil
+		}
+
+		return parseScalar(rv, key, node.values[0], opts)
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		return e.decodeSlice(rv, key, node, opts)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return errtools.InvalidTypeError(fmt.Sprintf("field %s - map keys must be strings", key))
+		}
+
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+
+		for name, child := range node.children {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := e.decodeValue(elem, nestedKey(key, name), child, opts); err != nil {
+				return err
+			}
+
+			rv.SetMapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()), elem)
+		}
+
+		return nil
+	case reflect.Struct:
+		var errs errtools.MultipleErrors
+		if errs = e.decodeStruct(rv, key, node, opts.tag, errs); len(errs) == 1 {
+			return errs[0]
+		} else if len(errs) > 0 {
+			return errs
+		}
+
+		return nil
+	}
+
+	return errtools.InvalidTypeError(fmt.Sprintf("field %s - cannot decode into %s", key, rv.Type()))
+}
+
+// Decode the fields of a struct, matching embedded struct fields at the same level
+func (e *Encoder) decodeStruct(rv reflect.Value, key string, node *valueNode, tag string, errs errtools.MultipleErrors) errtools.MultipleErrors {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, opts := e.parseTag(field, tag)
+		if name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct && !isScalarType(ft) {
+				if fv.Kind() == reflect.Pointer {
+					if !field.IsExported() {
+						continue
+					}
+
+					if fv.IsNil() {
+						fv.Set(reflect.New(ft))
+					}
+					fv = fv.Elem()
+				}
+
+				errs = e.decodeStruct(fv, key, node, tag, errs)
+				continue
+			}
+
+			if !field.IsExported() {
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		child, ok := node.children[name]
+		if !ok {
+			continue
+		}
+
+		if err := e.decodeValue(fv, nestedKey(key, name), child, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Decode a slice from repeated or comma separated values, or from indexed children
+func (e *Encoder) decodeSlice(rv reflect.Value, key string, node *valueNode, opts fieldOptions) error {
+	if node.children != nil {
+		indices, err := node.indices(key)
+		if err != nil {
+			return err
+		}
+
+		slice := reflect.MakeSlice(rv.Type(), len(indices), len(indices))
+		for i, index := range indices {
+			if err := e.decodeValue(slice.Index(i), nestedKey(key, index), node.children[index], opts); err != nil {
+				return err
+			}
+		}
+
+		rv.Set(slice)
+		return nil
+	}
+
+	items := node.values
+	if opts.arrayFormat == ArrayComma {
+		items = nil
+		for _, v := range node.values {
+			if v != "" {
+				items = append(items, strings.Split(v, ",")...)
+			}
+		}
+	}
+
+	slice := reflect.MakeSlice(rv.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := e.decodeValue(slice.Index(i), key, &valueNode{values: []string{item}}, opts); err != nil {
+			return err
+		}
+	}
+
+	rv.Set(slice)
+	return nil
+}
+
+// The child keys of a node in index order, all keys must be numeric
+func (n *valueNode) indices(key string) ([]string, error) {
+	indices := make([]string, 0, len(n.children))
+	for index := range n.children {
+		if _, err := strconv.Atoi(index); err != nil {
+			return nil, errtools.InvalidFieldError(fmt.Sprintf("field %s - %q is not a list index", key, index))
+		}
+
+		indices = append(indices, index)
+	}
+
+	sort.Slice(indices, func(i, j int) bool {
+		a, _ := strconv.Atoi(indices[i])
+		b, _ := strconv.Atoi(indices[j])
+		return a < b
+	})
+
+	return indices, nil
+}
+
+// Convert a node to map[string]interface{}, []interface{}, string or []string
+func (n *valueNode) generic() interface{} {
+	if n.children == nil {
+		if len(n.values) == 1 {
+			return n.values[0]
+		}
+
+		return n.values
+	}
+
+	if indices, err := n.indices(""); err == nil {
+		list := make([]interface{}, 0, len(indices))
+		for _, index := range indices {
+			list = append(list, n.children[index].generic())
+		}
+
+		return list
+	}
+
+	m := make(map[string]interface{}, len(n.children))
+	for name, child := range n.children {
+		m[name] = child.generic()
+	}
+
+	return m
+}
+
+// Parse a string into a scalar value
+func parseScalar(rv reflect.Value, key, value string, opts fieldOptions) error {
+	invalid := func(err error) error {
+		return errtools.InvalidFieldError(fmt.Sprintf("field %s - %s", key, err))
+	}
+
+	if rv.Type() == timeType {
+		var t time.Time
+		var err error
+
+		switch opts.timeFormat {
+		case "unix", "unixmilli":
+			var n int64
+			if n, err = strconv.ParseInt(value, 10, 64); err == nil {
+				if opts.timeFormat == "unix" {
+					t = time.Unix(n, 0)
+				} else {
+					t = time.UnixMilli(n)
+				}
+			}
+		default:
+			t, err = time.Parse(opts.timeFormat, value)
+		}
+
+		if err != nil {
+			return invalid(err)
+		}
+
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if reflect.PointerTo(rv.Type()).Implements(textUnmarshalerType) {
+		if err := rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return invalid(err)
+		}
+
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid(err)
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, rv.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, rv.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, rv.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		rv.SetFloat(f)
+	case reflect.Slice:
+		rv.SetBytes([]byte(value))
+	default:
+		return errtools.InvalidTypeError(fmt.Sprintf("field %s - cannot decode into %s", key, rv.Type()))
+	}
+
+	return nil
+}
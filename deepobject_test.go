@@ -0,0 +1,169 @@
+package greq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+type LineItem struct {
+	ID       string `form:"id"`
+	Quantity int    `form:"quantity,omitempty"`
+}
+
+type CheckoutForm struct {
+	Customer string            `form:"customer"`
+	Items    []LineItem        `form:"items"`
+	Metadata map[string]string `form:"metadata,omitempty"`
+	Tags     []string          `form:"tags,indices"`
+	Expires  time.Time         `form:"expires,unix"`
+}
+
+func TestDeepObjectEncoding(t *testing.T) {
+	encoder := greq.NewEncoder().WithDeepObject()
+
+	form := CheckoutForm{
+		Customer: "cus_123",
+		Items:    []LineItem{{ID: "price_1", Quantity: 2}, {ID: "price_2"}},
+		Metadata: map[string]string{"order": "42"},
+		Tags:     []string{"a", "b"},
+		Expires:  time.Unix(1700000000, 0),
+	}
+
+	values, err := encoder.Encode(form, "form")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"customer":           {"cus_123"},
+		"items[0][id]":       {"price_1"},
+		"items[0][quantity]": {"2"},
+		"items[1][id]":       {"price_2"},
+		"metadata[order]":    {"42"},
+		"tags[0]":            {"a"},
+		"tags[1]":            {"b"},
+		"expires":            {"1700000000"},
+	}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	decoded := CheckoutForm{}
+	if err := encoder.Decode(values, &decoded, "form"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, form) {
+		t.Errorf("expected %+v, got %+v", form, decoded)
+	}
+
+	values, err = encoder.Encode(map[string]interface{}{
+		"filters": map[string]interface{}{"status": "open", "ids": []int{1, 2}},
+	}, "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values.Encode() != "filters%5Bids%5D=1&filters%5Bids%5D=2&filters%5Bstatus%5D=open" {
+		t.Errorf("unexpected nested map encoding %s", values.Encode())
+	}
+
+	var generic interface{}
+	if err := encoder.Decode(values, &generic, "query"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedGeneric := map[string]interface{}{
+		"filters": map[string]interface{}{"status": "open", "ids": []string{"1", "2"}},
+	}
+
+	if !reflect.DeepEqual(generic, expectedGeneric) {
+		t.Errorf("expected %v, got %v", expectedGeneric, generic)
+	}
+
+	if _, err := greq.NewEncoder().Encode(form, "form"); err == nil {
+		t.Error("expected an error for nested values without deepobject")
+	}
+
+	tagged := struct {
+		Filter map[string]string `query:"filter,deepobject"`
+	}{map[string]string{"status": "open"}}
+
+	values, err = greq.NewEncoder().Encode(tagged, "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values.Get("filter[status]") != "open" {
+		t.Errorf("unexpected deepobject field encoding %v", values)
+	}
+}
+
+func TestDeepObjectDecoding(t *testing.T) {
+	values, err := url.ParseQuery("items[1][id]=b&items[0][id]=a&tags[]=x&tags[]=y&csv=1,2&meta[k]=v")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := struct {
+		Items []struct {
+			ID string `query:"id"`
+		} `query:"items"`
+		Tags []string           `query:"tags"`
+		CSV  []int              `query:"csv,comma"`
+		Meta map[string]*string `query:"meta"`
+	}{}
+
+	if err := greq.NewEncoder().Decode(values, &target, "query"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(target.Items) != 2 || target.Items[0].ID != "a" || target.Items[1].ID != "b" {
+		t.Errorf("unexpected items %+v", target.Items)
+	}
+
+	if !reflect.DeepEqual(target.Tags, []string{"x", "y"}) || !reflect.DeepEqual(target.CSV, []int{1, 2}) {
+		t.Errorf("unexpected lists %v %v", target.Tags, target.CSV)
+	}
+
+	if target.Meta["k"] == nil || *target.Meta["k"] != "v" {
+		t.Errorf("unexpected map %v", target.Meta)
+	}
+
+	invalid := struct {
+		Items []string `query:"items"`
+	}{}
+
+	if err := greq.NewEncoder().Decode(url.Values{"items[a]": {"1"}}, &invalid, "query"); err == nil {
+		t.Error("expected an error for a non-numeric list index")
+	}
+}
+
+func TestDeepObjectRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("X-Query", r.URL.Query().Get("filters[status]"))
+		w.Header().Set("X-Form", r.PostForm.Get("items[0][id]"))
+	}))
+	defer server.Close()
+
+	resp, err := greq.PostRequest(server.URL).
+		WithEncoder(greq.NewEncoder().WithDeepObject()).
+		WithQueryParams(map[string]interface{}{"filters": map[string]string{"status": "open"}}).
+		WithUrlencodedFormBody(CheckoutForm{Items: []LineItem{{ID: "price_1"}}}, nil).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Response.Header.Get("X-Query") != "open" || resp.Response.Header.Get("X-Form") != "price_1" {
+		t.Errorf("unexpected values %v", resp.Response.Header)
+	}
+}
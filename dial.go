@@ -0,0 +1,228 @@
+package greq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Which IP address family to use when connecting
+type IPFamily string
+
+const (
+	// Use the addresses in the order returned by the resolver
+	AnyIPFamily IPFamily = ""
+	// Try IPv4 addresses first, then IPv6
+	PreferIPv4 IPFamily = "prefer-ipv4"
+	// Try IPv6 addresses first, then IPv4
+	PreferIPv6 IPFamily = "prefer-ipv6"
+	// Only connect to IPv4 addresses
+	IPv4Only IPFamily = "ipv4"
+	// Only connect to IPv6 addresses
+	IPv6Only IPFamily = "ipv6"
+)
+
+// Resolves host names to IP addresses
+// *net.Resolver implements this interface, so a resolver using a custom
+// DNS server can be created with net.Resolver{PreferGo: true, Dial: ...}
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Connection settings for a request
+type dialOptions struct {
+	resolve   map[string]net.IP
+	resolver  Resolver
+	family    IPFamily
+	localAddr net.IP
+
+	unixSocket string
+
+	egress *EgressPolicy
+}
+
+func (g *GRequest) dialOptions() *dialOptions {
+	if g.dial == nil {
+		g.dial = &dialOptions{}
+	}
+
+	return g.dial
+}
+
+// Connect to a specific IP for a host, keeping the Host header and TLS server name
+// The host can be given as host:port to only override a single port, similar to curl --resolve
+func (g *GRequest) WithResolve(host, ip string) *GRequest {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		g.addError(fmt.Errorf("invalid ip address for %s: %s", host, ip))
+		return g
+	}
+
+	d := g.dialOptions()
+	if d.resolve == nil {
+		d.resolve = make(map[string]net.IP)
+	}
+
+	d.resolve[host] = parsed
+
+	return g
+}
+
+// Use a custom resolver to look up host names
+func (g *GRequest) WithResolver(resolver Resolver) *GRequest {
+	g.dialOptions().resolver = resolver
+	return g
+}
+
+// Set which IP address family to use when connecting
+func (g *GRequest) WithIPFamily(family IPFamily) *GRequest {
+	switch family {
+	case AnyIPFamily, PreferIPv4, PreferIPv6, IPv4Only, IPv6Only:
+		g.dialOptions().family = family
+	default:
+		g.addError(fmt.Errorf("invalid ip family: %s", family))
+	}
+
+	return g
+}
+
+// Bind outgoing connections to a local IP address
+func (g *GRequest) WithLocalAddr(ip string) *GRequest {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		g.addError(fmt.Errorf("invalid local ip address: %s", ip))
+		return g
+	}
+
+	g.dialOptions().localAddr = parsed
+	return g
+}
+
+func (d *dialOptions) apply(t *http.Transport) error {
+	if d.egress != nil {
+		compiled, err := d.egress.compile()
+		if err != nil {
+			return err
+		}
+
+		d.egress = compiled
+
+		// A proxy would make the policy check the proxy address instead of the target
+		t.Proxy = nil
+	}
+
+	t.DialContext = d.dialContext
+	return nil
+}
+
+// Resolve the address and connect to the first IP that accepts the connection,
+// or connect to the unix socket if one is set
+func (d *dialOptions) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if d.unixSocket != "" {
+		if d.egress != nil {
+			return nil, &EgressError{Reason: ErrDeniedAddress, Host: d.unixSocket}
+		}
+
+		return dialer.DialContext(ctx, "unix", d.unixSocket)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.egress != nil {
+		portNum, _ := strconv.Atoi(port)
+		if err := d.egress.checkHost(host, portNum); err != nil {
+			return nil, err
+		}
+
+		dialer.Control = d.egress.control
+	}
+
+	ips, err := d.lookup(ctx, addr, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.localAddr != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: d.localAddr}
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Get the IPs to try for an address, in the order they should be tried
+func (d *dialOptions) lookup(ctx context.Context, addr, host string) ([]net.IP, error) {
+	if ip, ok := d.resolve[addr]; ok {
+		return []net.IP{ip}, nil
+	}
+
+	if ip, ok := d.resolve[host]; ok {
+		return []net.IP{ip}, nil
+	}
+
+	var ips []net.IP
+
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		resolver := d.resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch d.family {
+	case PreferIPv4:
+		ips = append(v4, v6...)
+	case PreferIPv6:
+		ips = append(v6, v4...)
+	case IPv4Only:
+		ips = v4
+	case IPv6Only:
+		ips = v6
+	}
+
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no addresses found for the requested ip family", Name: host, IsNotFound: true}
+	}
+
+	return ips, nil
+}
@@ -0,0 +1,87 @@
+package greq_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+type fakeResolver map[string]string
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ip, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "not found", Name: host, IsNotFound: true}
+	}
+
+	return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+}
+
+func TestWithResolveKeepsHostAndSNI(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Host, r.TLS.ServerName)
+	}))
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	client := server.Client()
+
+	resp, err := greq.GetRequest(fmt.Sprintf("https://example.com:%d/", port)).
+		WithClient(client).
+		WithResolve(fmt.Sprintf("example.com:%d", port), "127.0.0.1").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("example.com:%d example.com", port)
+	if body != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+}
+
+func TestWithResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	resolver := fakeResolver{"service.internal": "127.0.0.1"}
+
+	resp, err := greq.GetRequest(fmt.Sprintf("http://service.internal:%d/", port)).
+		WithResolver(resolver).
+		WithIPFamily(greq.PreferIPv4).
+		WithLocalAddr("127.0.0.1").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != fmt.Sprintf("service.internal:%d", port) {
+		t.Errorf("unexpected host %s", body)
+	}
+
+	_, err = greq.GetRequest(fmt.Sprintf("http://service.internal:%d/", port)).
+		WithResolver(resolver).
+		WithIPFamily(greq.IPv6Only).
+		Execute()
+	if err == nil {
+		t.Fatal("expected an error when no address matches the ip family")
+	}
+}
@@ -0,0 +1,105 @@
+package greq
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// Execute the request and decode a 2xx response body into T
+// The body is decoded with GResponse.Unmarshal based on its Content-Type. A T of string or
+// []byte gets the body as it is, and an empty body (for example 204 No Content) leaves T empty.
+// Responses with another status return an *HTTPError, for example:
+//
+//	user, resp, err := greq.Do[User](greq.GetRequest("https://api.example.com/users/1"))
+func Do[T any](req *GRequest) (T, *GResponse, error) {
+	var result T
+
+	resp, err := req.Execute()
+	if err != nil {
+		return result, resp, err
+	}
+
+	if !isSuccess(resp.StatusCode) {
+		return result, resp, newHTTPError(resp, resp.errorBody())
+	}
+
+	err = decodeResponse(resp, &result)
+	return result, resp, err
+}
+
+// Execute the request, decoding a 2xx response body into T and other responses into E
+// For responses that are not 2xx, the error is an *HTTPError and the decoded body is returned
+// as *E. If the error body cannot be decoded or is longer than ErrorBodyLimit, *E is nil.
+//
+//	user, apiErr, resp, err := greq.DoWithError[User, APIError](greq.GetRequest("https://api.example.com/users/1"))
+func DoWithError[T, E any](req *GRequest) (T, *E, *GResponse, error) {
+	var result T
+
+	resp, err := req.Execute()
+	if err == nil && !isSuccess(resp.StatusCode) {
+		err = newHTTPError(resp, resp.errorBody())
+	}
+
+	// E is decoded from the start of the body kept in the error, which is
+	// skipped if the body was longer than ErrorBodyLimit
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && resp != nil {
+		var errBody E
+		if httpErr.Truncated || decodeBytes(resp, httpErr.Body, &errBody) != nil {
+			return result, nil, resp, err
+		}
+
+		return result, &errBody, resp, err
+	}
+
+	if err != nil {
+		return result, nil, resp, err
+	}
+
+	err = decodeResponse(resp, &result)
+	return result, nil, resp, err
+}
+
+func isSuccess(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+// Decode the response body into v, which must be a pointer
+func decodeResponse(resp *GResponse, v interface{}) error {
+	body, err := resp.BodyBytes()
+	if err != nil {
+		return err
+	}
+
+	return decodeBytes(resp, body, v)
+}
+
+// Decode a body read from the response into v, which must be a pointer
+func decodeBytes(resp *GResponse, body []byte, v interface{}) error {
+	switch target := v.(type) {
+	case *string:
+		*target = string(body)
+		return nil
+	case *[]byte:
+		*target = body
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusNoContent || len(body) == 0 {
+		return nil
+	}
+
+	// Decode into a new value for pointer types, so a proto.Message can be decoded
+	if rv := reflect.ValueOf(v).Elem(); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		rv.Set(reflect.New(rv.Type().Elem()))
+		v = rv.Interface()
+	}
+
+	decode, label, err := resp.contentDecoder()
+	if err != nil {
+		return err
+	}
+
+	return decodeCharset(decode, label, body, v)
+}
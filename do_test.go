@@ -0,0 +1,102 @@
+package greq_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/clysec/greq"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func TestDo(t *testing.T) {
+	server := newTestServer(t, routes{
+		"/pet":     respond(http.StatusOK, "application/json", `{"name":"Rex","tags":["dog"]}`),
+		"/proto":   respond(http.StatusOK, "application/x-protobuf", "\x0a\x03Rex"),
+		"/text":    respond(http.StatusOK, "", "plain text"),
+		"/empty":   respond(http.StatusNoContent, "", ""),
+		"/problem": respond(http.StatusNotFound, "application/problem+json", notFoundProblem),
+	})
+
+	pet, resp, err := greq.Do[Pet](greq.GetRequest(server.URL + "/pet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pet.Name != "Rex" || resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected pet %+v", pet)
+	}
+
+	message, _, err := greq.Do[*wrapperspb.StringValue](greq.GetRequest(server.URL + "/proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.GetValue() != "Rex" {
+		t.Errorf("unexpected message %v", message)
+	}
+
+	text, _, err := greq.Do[string](greq.GetRequest(server.URL + "/text"))
+	if err != nil || text != "plain text" {
+		t.Errorf("unexpected text %q %v", text, err)
+	}
+
+	empty, _, err := greq.Do[Pet](greq.DeleteRequest(server.URL + "/empty"))
+	if err != nil || empty.Name != "" {
+		t.Errorf("unexpected empty response %+v %v", empty, err)
+	}
+
+	_, resp, err = greq.Do[Pet](greq.GetRequest(server.URL + "/problem"))
+
+	var httpErr *greq.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+
+	if httpErr.StatusCode != http.StatusNotFound || httpErr.Method != http.MethodGet || httpErr.URL != server.URL+"/problem" || resp == nil {
+		t.Errorf("unexpected error %+v", httpErr)
+	}
+}
+
+func TestDoWithError(t *testing.T) {
+	server := newTestServer(t, routes{
+		"/pet":     respond(http.StatusOK, "application/json", `{"name":"Rex","tags":["dog"]}`),
+		"/problem": respond(http.StatusNotFound, "application/problem+json", notFoundProblem),
+		"/large":   respond(http.StatusBadGateway, "application/json", `{"code":"`+strings.Repeat("x", 3*greq.ErrorBodyLimit)+`"}`),
+		"/":        respond(http.StatusInternalServerError, "", "<html>oops</html>"),
+	})
+
+	pet, apiErr, _, err := greq.DoWithError[Pet, APIError](greq.GetRequest(server.URL + "/pet"))
+	if err != nil || apiErr != nil || pet.Name != "Rex" {
+		t.Errorf("unexpected result %+v %v %v", pet, apiErr, err)
+	}
+
+	_, apiErr, resp, err := greq.DoWithError[Pet, APIError](greq.GetRequest(server.URL + "/problem"))
+
+	var httpErr *greq.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+
+	if apiErr == nil || apiErr.Code != "not_found" || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected error body %+v", apiErr)
+	}
+
+	// An error body that cannot be decoded still returns the HTTPError
+	_, apiErr, _, err = greq.DoWithError[Pet, APIError](greq.GetRequest(server.URL + "/fail"))
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError || apiErr != nil {
+		t.Errorf("unexpected result %v %v", apiErr, err)
+	}
+
+	// Only the start of a large error body is read, so it is not decoded
+	_, apiErr, _, err = greq.DoWithError[Pet, APIError](greq.GetRequest(server.URL + "/large"))
+	if !errors.As(err, &httpErr) || !httpErr.Truncated || len(httpErr.Body) != greq.ErrorBodyLimit || apiErr != nil {
+		t.Errorf("expected a truncated error body, got %v %v", apiErr, err)
+	}
+}
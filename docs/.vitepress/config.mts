@@ -17,7 +17,11 @@ export default defineConfig({
         text: 'Introduction',
         items: [
           { text: 'Getting Started', link: '/getting-started' },
-          { text: 'Query and Headers', link: '/query-and-headers' }
+          { text: 'Query and Headers', link: '/query-and-headers' },
+          { text: 'TLS Configuration', link: '/tls' },
+          { text: 'Connection Settings', link: '/connection' },
+          { text: 'Progress and Bandwidth', link: '/transfers' },
+          { text: 'Error Handling', link: '/errors' }
         ]
       },
       {
@@ -28,6 +32,7 @@ export default defineConfig({
           { text: 'PUT', link: '/put-request' },
           { text: 'PATCH', link: '/patch-request' },
           { text: 'DELETE', link: '/delete-request' },
+          { text: 'Other Methods', link: '/other-methods' },
         ]
       },
       {
@@ -37,6 +42,7 @@ export default defineConfig({
           { text: 'URL-Encoded Form', link: '/body-form' },
           { text: 'Multipart Form', link: '/body-multipart' },
           { text: 'Raw String/Bytes', link: '/body-raw' },
+          { text: 'Compression', link: '/compression' },
           { text: 'SOAP Request', link: '/body-soap' },
           { text: 'GraphQL Request', link: '/body-graphql' },
         ],
@@ -58,8 +64,11 @@ export default defineConfig({
           { text: 'NTLM', link: '/auth-ntlm' },
           { text: 'Oauth2', link: '/auth-oauth2' },
           { text: 'Header', link: '/auth-header' },
+          { text: 'API Key', link: '/auth-apikey' },
+          { text: 'Netrc/Credential Helpers', link: '/auth-netrc' },
           { text: 'Bearer Token', link: '/auth-bearer' },
           { text: 'mTLS/Cert Auth', link: '/auth-cert' },
+          { text: 'Chaining and Routing', link: '/auth-chain' },
           { text: 'Custom Modules', link: '/auth-custom' },
         ]
       },
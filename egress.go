@@ -0,0 +1,239 @@
+package greq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var (
+	// The connection was denied because of the IP address it resolved to
+	ErrDeniedAddress = errors.New("egress denied: address not allowed")
+	// The connection was denied because the host is not in the allowlist
+	ErrDeniedHost = errors.New("egress denied: host not allowed")
+	// The connection was denied because the port is not in the allowlist
+	ErrDeniedPort = errors.New("egress denied: port not allowed")
+)
+
+// Returned when a connection is blocked by an EgressPolicy
+// Use errors.Is with ErrDeniedAddress, ErrDeniedHost or ErrDeniedPort to check the reason
+type EgressError struct {
+	Reason error
+	Host   string
+	IP     net.IP
+	Port   int
+}
+
+func (e *EgressError) Error() string {
+	target := e.Host
+	if e.IP != nil {
+		target = e.IP.String()
+	}
+
+	if e.Port != 0 {
+		target = net.JoinHostPort(target, strconv.Itoa(e.Port))
+	}
+
+	return fmt.Sprintf("%s: %s", e.Reason, target)
+}
+
+func (e *EgressError) Unwrap() error {
+	return e.Reason
+}
+
+// Networks that are blocked by DenyPrivate in addition to the
+// loopback, private, link-local, multicast and unspecified ranges
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// Restricts which hosts, addresses and ports requests can connect to, for
+// example when calling user supplied URLs.
+// The policy is enforced every time a connection is made, including for redirects,
+// and the address is checked after DNS resolution to prevent DNS rebinding.
+// Proxies from the environment are not used when a policy is set, and unix sockets are denied.
+type EgressPolicy struct {
+	// Deny loopback, private, link-local, multicast, unspecified and other reserved addresses
+	DenyPrivate bool
+
+	// Additional networks to deny, in CIDR notation
+	DeniedNetworks []string
+	// Networks to allow even if they are denied by DenyPrivate or DeniedNetworks, in CIDR notation
+	AllowedNetworks []string
+
+	// Hosts that can be connected to, either exact names or *.example.com for subdomains
+	// All hosts are allowed if empty
+	AllowedHosts []string
+	// Ports that can be connected to, all ports are allowed if empty
+	AllowedPorts []int
+
+	denied  []*net.IPNet
+	allowed []*net.IPNet
+}
+
+// A policy that blocks private and reserved addresses
+func NewEgressPolicy() *EgressPolicy {
+	return &EgressPolicy{DenyPrivate: true}
+}
+
+// Only allow connections to the given hosts
+func (p *EgressPolicy) AllowHosts(hosts ...string) *EgressPolicy {
+	p.AllowedHosts = append(p.AllowedHosts, hosts...)
+	return p
+}
+
+// Only allow connections to the given ports
+func (p *EgressPolicy) AllowPorts(ports ...int) *EgressPolicy {
+	p.AllowedPorts = append(p.AllowedPorts, ports...)
+	return p
+}
+
+// Allow connections to networks that are otherwise denied
+func (p *EgressPolicy) AllowNetworks(cidrs ...string) *EgressPolicy {
+	p.AllowedNetworks = append(p.AllowedNetworks, cidrs...)
+	return p
+}
+
+// Deny connections to additional networks
+func (p *EgressPolicy) DenyNetworks(cidrs ...string) *EgressPolicy {
+	p.DeniedNetworks = append(p.DeniedNetworks, cidrs...)
+	return p
+}
+
+// Get a copy of the policy with the networks parsed
+// A copy is used so a policy can be shared between requests running concurrently
+func (p *EgressPolicy) compile() (*EgressPolicy, error) {
+	compiled := *p
+	compiled.denied = nil
+	compiled.allowed = nil
+
+	for _, cidr := range p.DeniedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied network %s: %w", cidr, err)
+		}
+
+		compiled.denied = append(compiled.denied, network)
+	}
+
+	for _, cidr := range p.AllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %s: %w", cidr, err)
+		}
+
+		compiled.allowed = append(compiled.allowed, network)
+	}
+
+	return &compiled, nil
+}
+
+// Check the host and port before resolving the address
+func (p *EgressPolicy) checkHost(host string, port int) error {
+	if len(p.AllowedPorts) > 0 {
+		allowed := false
+		for _, allowedPort := range p.AllowedPorts {
+			if allowedPort == port {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return &EgressError{Reason: ErrDeniedPort, Host: host, Port: port}
+		}
+	}
+
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range p.AllowedHosts {
+		pattern = strings.ToLower(pattern)
+
+		if pattern == host || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return nil
+		}
+	}
+
+	return &EgressError{Reason: ErrDeniedHost, Host: host, Port: port}
+}
+
+// Check the resolved IP address that is about to be connected to
+func (p *EgressPolicy) checkIP(ip net.IP, port int) error {
+	for _, network := range p.allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	denied := false
+
+	if p.DenyPrivate {
+		denied = ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+			ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+			ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+
+		for _, network := range reservedNetworks {
+			denied = denied || network.Contains(ip)
+		}
+	}
+
+	for _, network := range p.denied {
+		denied = denied || network.Contains(ip)
+	}
+
+	if denied {
+		return &EgressError{Reason: ErrDeniedAddress, IP: ip, Port: port}
+	}
+
+	return nil
+}
+
+// Enforce an egress policy on the request
+func (g *GRequest) WithEgressPolicy(policy *EgressPolicy) *GRequest {
+	g.dialOptions().egress = policy
+	return g
+}
+
+// Used as net.Dialer.Control to check the address after it has been resolved
+func (p *EgressPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("egress policy: cannot parse dialed address %s", address)
+	}
+
+	port, _ := strconv.Atoi(portStr)
+
+	return p.checkIP(ip, port)
+}
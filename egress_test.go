@@ -0,0 +1,83 @@
+package greq_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+func TestEgressPolicyDeniesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := greq.GetRequest(server.URL).WithEgressPolicy(greq.NewEgressPolicy()).Execute()
+
+	var egressErr *greq.EgressError
+	if !errors.As(err, &egressErr) || !errors.Is(err, greq.ErrDeniedAddress) {
+		t.Fatalf("expected a denied address error, got %v", err)
+	}
+
+	if !egressErr.IP.IsLoopback() {
+		t.Errorf("expected the loopback address in the error, got %s", egressErr.IP)
+	}
+
+	// Resolving a public looking name to a private address is also denied
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	_, err = greq.GetRequest(fmt.Sprintf("http://rebind.example:%d/", port)).
+		WithResolver(fakeResolver{"rebind.example": "127.0.0.1"}).
+		WithEgressPolicy(greq.NewEgressPolicy()).
+		Execute()
+	if !errors.Is(err, greq.ErrDeniedAddress) {
+		t.Fatalf("expected a denied address error, got %v", err)
+	}
+
+	resp, err := greq.GetRequest(server.URL).
+		WithEgressPolicy(greq.NewEgressPolicy().AllowNetworks("127.0.0.0/8")).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestEgressPolicyRedirects(t *testing.T) {
+	var port int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == fmt.Sprintf("allowed.test:%d", port) {
+			http.Redirect(w, r, fmt.Sprintf("http://denied.test:%d/", port), http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	port = server.Listener.Addr().(*net.TCPAddr).Port
+
+	policy := &greq.EgressPolicy{AllowedHosts: []string{"allowed.test"}}
+
+	_, err := greq.GetRequest(fmt.Sprintf("http://allowed.test:%d/", port)).
+		WithResolve("allowed.test", "127.0.0.1").
+		WithResolve("denied.test", "127.0.0.1").
+		WithEgressPolicy(policy).
+		Execute()
+	if !errors.Is(err, greq.ErrDeniedHost) {
+		t.Fatalf("expected a denied host error, got %v", err)
+	}
+}
+
+func TestEgressPolicyPorts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := greq.GetRequest(server.URL).
+		WithEgressPolicy((&greq.EgressPolicy{}).AllowPorts(443)).
+		Execute()
+	if !errors.Is(err, greq.ErrDeniedPort) {
+		t.Fatalf("expected a denied port error, got %v", err)
+	}
+}
@@ -0,0 +1,454 @@
+package greq
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// How slices and arrays are encoded into query, form and header values
+type ArrayFormat int
+
+const (
+	// Repeat the key for each value: a=1&a=2
+	ArrayRepeat ArrayFormat = iota
+	// Join the values with a comma: a=1,2
+	ArrayComma
+	// Repeat the key with empty brackets for each value: a[]=1&a[]=2
+	ArrayBrackets
+	// Add the index in brackets to the key: a[0]=1&a[1]=2
+	ArrayIndices
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Encoder converts structs and maps into url.Values for query parameters,
+// urlencoded forms and headers.
+//
+// Struct fields are read from the tag passed to Encode (query, form or header), for example:
+//
+//	type Search struct {
+//		Query  string    `query:"q"`
+//		Tags   []string  `query:"tag,omitempty,comma"`
+//		Since  time.Time `query:"since,omitempty" layout:"2006-01-02"`
+//		Paging           // embedded structs are flattened
+//	}
+//
+// The first part of the tag is the name, "-" skips the field and an empty name uses the field name.
+// The options are omitempty, an array format (repeat, comma, brackets or indices), a time format
+// (unix or unixmilli) and deepobject.
+// Times are formatted using the layout tag, or the encoder TimeLayout if the field has none.
+//
+// Nested maps, structs and slices of them are rejected unless DeepObject is enabled on the encoder or
+// the deepobject option is set on the field, in which case they are encoded with bracket notation:
+// filter[status]=open&items[0][id]=1
+type Encoder struct {
+	// Default format for slices and arrays, can be overridden per field
+	ArrayFormat ArrayFormat
+	// Default layout for time.Time values, defaults to time.RFC3339
+	TimeLayout string
+	// Encode nested values with bracket notation
+	DeepObject bool
+}
+
+// Create a new encoder with the default settings
+func NewEncoder() *Encoder {
+	return &Encoder{
+		ArrayFormat: ArrayRepeat,
+		TimeLayout:  time.RFC3339,
+	}
+}
+
+// Set the default array format
+func (e *Encoder) WithArrayFormat(format ArrayFormat) *Encoder {
+	e.ArrayFormat = format
+	return e
+}
+
+// Set the default time layout
+func (e *Encoder) WithTimeLayout(layout string) *Encoder {
+	e.TimeLayout = layout
+	return e
+}
+
+// Encode nested maps, structs and slices with bracket notation (filter[status]=open&items[0][id]=1)
+// as used by OpenAPI deepObject parameters, Stripe, PHP and Rails
+func (e *Encoder) WithDeepObject() *Encoder {
+	e.DeepObject = true
+	return e
+}
+
+// Options for a single field, from the encoder defaults and the struct tag
+type fieldOptions struct {
+	tag         string
+	omitEmpty   bool
+	deepObject  bool
+	arrayFormat ArrayFormat
+	timeFormat  string
+}
+
+func (e *Encoder) defaultOptions(tag string) fieldOptions {
+	layout := e.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	return fieldOptions{tag: tag, arrayFormat: e.ArrayFormat, timeFormat: layout, deepObject: e.DeepObject}
+}
+
+// Encode a struct, a map with string keys or url.Values into url.Values
+// The tag is used to read the field names and options from structs
+func (e *Encoder) Encode(v interface{}, tag string) (url.Values, error) {
+	values := url.Values{}
+
+	if vt, ok := v.(url.Values); ok {
+		for k, v := range vt {
+			values[k] = append(values[k], v...)
+		}
+
+		return values, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+
+	var errs errtools.MultipleErrors
+
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		for _, k := range keys {
+			if err := e.encodeValue(values, k.String(), rv.MapIndex(k), e.defaultOptions(tag)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case rv.Kind() == reflect.Struct && !isScalarType(rv.Type()):
+		errs = e.encodeStruct(values, "", rv, tag, errs)
+	default:
+		return nil, errtools.InvalidTypeError(fmt.Sprintf("cannot encode %s, must be a struct, a map with string keys or url.Values", rv.Type()))
+	}
+
+	if len(errs) == 1 {
+		return nil, errs[0]
+	} else if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return values, nil
+}
+
+// Encode the exported fields of a struct, flattening embedded structs
+// Fields of nested structs are prefixed with the key of the struct: prefix[field]
+func (e *Encoder) encodeStruct(values url.Values, prefix string, rv reflect.Value, tag string, errs errtools.MultipleErrors) errtools.MultipleErrors {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, opts := e.parseTag(field, tag)
+		if name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct && !isScalarType(ft) {
+				if fv.Kind() == reflect.Pointer {
+					if fv.IsNil() {
+						continue
+					}
+					fv = fv.Elem()
+				}
+
+				errs = e.encodeStruct(values, prefix, fv, tag, errs)
+				continue
+			}
+
+			if !field.IsExported() {
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if opts.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		if err := e.encodeValue(values, nestedKey(prefix, name), fv, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func nestedKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "[" + key + "]"
+}
+
+// Read the name and options for a field
+func (e *Encoder) parseTag(field reflect.StructField, tag string) (string, fieldOptions) {
+	opts := e.defaultOptions(tag)
+	if layout, ok := field.Tag.Lookup("layout"); ok {
+		opts.timeFormat = layout
+	}
+
+	parts := strings.Split(field.Tag.Get(tag), ",")
+	for _, option := range parts[1:] {
+		switch option {
+		case "omitempty":
+			opts.omitEmpty = true
+		case "repeat":
+			opts.arrayFormat = ArrayRepeat
+		case "comma":
+			opts.arrayFormat = ArrayComma
+		case "brackets":
+			opts.arrayFormat = ArrayBrackets
+		case "indices":
+			opts.arrayFormat = ArrayIndices
+		case "deepobject":
+			opts.deepObject = true
+		case "unix", "unixmilli":
+			opts.timeFormat = option
+		}
+	}
+
+	return parts[0], opts
+}
+
+// Encode a single value, which can be a scalar, a slice of scalars or a nested value
+func (e *Encoder) encodeValue(values url.Values, key string, rv reflect.Value, opts fieldOptions) error {
+	str, ok, err := formatScalar(rv, opts)
+	if err != nil {
+		return errtools.InvalidFieldError(fmt.Sprintf("field %s - %s", key, err))
+	}
+
+	if ok {
+		values.Add(key, str)
+		return nil
+	}
+
+	rv = indirect(rv)
+	nestedError := errtools.InvalidTypeError(fmt.Sprintf("field %s - cannot encode nested value of type %s, use deepobject to encode it with bracket notation", key, rv.Type()))
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+	case reflect.Map:
+		if !opts.deepObject || rv.Type().Key().Kind() != reflect.String {
+			return nestedError
+		}
+
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		for _, k := range keys {
+			if err := e.encodeValue(values, nestedKey(key, k.String()), rv.MapIndex(k), opts); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Struct:
+		if !opts.deepObject {
+			return nestedError
+		}
+
+		if errs := e.encodeStruct(values, key, rv, opts.tag, nil); len(errs) > 0 {
+			return errs[0]
+		}
+
+		return nil
+	default:
+		return nestedError
+	}
+
+	items := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		str, ok, err := formatScalar(rv.Index(i), opts)
+		if err != nil {
+			return errtools.InvalidFieldError(fmt.Sprintf("field %s - %s", key, err))
+		}
+
+		if !ok {
+			if !opts.deepObject {
+				return errtools.InvalidTypeError(fmt.Sprintf("field %s - cannot encode nested value of type %s, use deepobject to encode it with bracket notation", key, rv.Index(i).Type()))
+			}
+
+			if err := e.encodeValue(values, nestedKey(key, strconv.Itoa(i)), rv.Index(i), opts); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		items = append(items, str)
+	}
+
+	switch opts.arrayFormat {
+	case ArrayComma:
+		if len(items) > 0 {
+			values.Add(key, strings.Join(items, ","))
+		}
+	case ArrayBrackets:
+		for _, item := range items {
+			values.Add(key+"[]", item)
+		}
+	case ArrayIndices:
+		for i, item := range items {
+			values.Add(nestedKey(key, strconv.Itoa(i)), item)
+		}
+	default:
+		for _, item := range items {
+			values.Add(key, item)
+		}
+	}
+
+	return nil
+}
+
+// Dereference pointers and interfaces, stopping at nil
+func indirect(rv reflect.Value) reflect.Value {
+	for (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	return rv
+}
+
+// Whether a type is encoded as a single value
+func isScalarType(rt reflect.Type) bool {
+	if rt == timeType || rt.Implements(textMarshalerType) || reflect.PointerTo(rt).Implements(textMarshalerType) {
+		return true
+	}
+
+	switch rt.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return rt.Elem().Kind() == reflect.Uint8
+	}
+
+	return false
+}
+
+// Format a scalar value as a string, returning false if the value is not a scalar
+// Nil pointers and interfaces are formatted as an empty string
+func formatScalar(rv reflect.Value, opts fieldOptions) (string, bool, error) {
+	if !rv.IsValid() {
+		return "", true, nil
+	}
+
+	rv = indirect(rv)
+	if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil() {
+		return "", true, nil
+	}
+
+	if rv.Type() == timeType {
+		t := rv.Interface().(time.Time)
+
+		switch opts.timeFormat {
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10), true, nil
+		case "unixmilli":
+			return strconv.FormatInt(t.UnixMilli(), 10), true, nil
+		}
+
+		return t.Format(opts.timeFormat), true, nil
+	}
+
+	if marshaler, ok := textMarshaler(rv); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), true, err
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true, nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), true, nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), true, nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+func textMarshaler(rv reflect.Value) (encoding.TextMarshaler, bool) {
+	if rv.Type().Implements(textMarshalerType) {
+		return rv.Interface().(encoding.TextMarshaler), true
+	}
+
+	if reflect.PointerTo(rv.Type()).Implements(textMarshalerType) {
+		if !rv.CanAddr() {
+			addressable := reflect.New(rv.Type()).Elem()
+			addressable.Set(rv)
+			rv = addressable
+		}
+
+		return rv.Addr().Interface().(encoding.TextMarshaler), true
+	}
+
+	return nil, false
+}
+
+// Whether a value should be skipped with omitempty
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	if rv.Type() == timeType {
+		return rv.Interface().(time.Time).IsZero()
+	}
+
+	return rv.IsZero()
+}
@@ -0,0 +1,139 @@
+package greq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+type Paging struct {
+	Page    int `query:"page" form:"page"`
+	PerPage int `query:"per_page,omitempty" form:"per_page,omitempty"`
+}
+
+type SearchParams struct {
+	Paging
+	Query    string     `query:"q" form:"q" header:"X-Query"`
+	Tags     []string   `query:"tag,omitempty" form:"tags,comma" header:"X-Tag"`
+	Labels   []string   `query:"label,brackets,omitempty"`
+	Since    time.Time  `query:"since,omitempty" layout:"2006-01-02"`
+	Until    *time.Time `query:"until,unix,omitempty"`
+	Archived *bool      `query:"archived,omitempty"`
+	Internal string     `query:"-" form:"-" header:"-"`
+	Score    float64
+}
+
+func TestEncoder(t *testing.T) {
+	until := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	archived := false
+
+	params := SearchParams{
+		Paging:   Paging{Page: 2},
+		Query:    "greq go",
+		Tags:     []string{"http", "client"},
+		Labels:   []string{"a", "b"},
+		Since:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Until:    &until,
+		Archived: &archived,
+		Internal: "secret",
+		Score:    1.5,
+	}
+
+	values, err := greq.NewEncoder().Encode(params, "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"page":     {"2"},
+		"q":        {"greq go"},
+		"tag":      {"http", "client"},
+		"label[]":  {"a", "b"},
+		"since":    {"2024-01-01"},
+		"until":    {"1704153600"},
+		"archived": {"false"},
+		"Score":    {"1.5"},
+	}
+
+	if values.Encode() != expected.Encode() {
+		t.Errorf("expected %s, got %s", expected.Encode(), values.Encode())
+	}
+
+	values, err = greq.NewEncoder().Encode(&SearchParams{Tags: []string{"a", "b"}}, "form")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values.Get("tags") != "a,b" || values.Has("per_page") || !values.Has("q") {
+		t.Errorf("unexpected form values %s", values.Encode())
+	}
+
+	values, err = greq.NewEncoder().WithArrayFormat(greq.ArrayComma).Encode(map[string]interface{}{
+		"ids":  []int{1, 2, 3},
+		"at":   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"name": &params.Query,
+		"raw":  []byte("bytes"),
+	}, "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values.Encode() != "at=2024-01-01T00%3A00%3A00Z&ids=1%2C2%2C3&name=greq+go&raw=bytes" {
+		t.Errorf("unexpected map values %s", values.Encode())
+	}
+
+	invalid := []interface{}{
+		"string",
+		map[string]interface{}{"nested": map[string]string{"a": "b"}},
+		struct {
+			Nested struct{ A string } `query:"nested"`
+		}{},
+	}
+
+	for _, v := range invalid {
+		if _, err := greq.NewEncoder().Encode(v, "query"); err == nil {
+			t.Errorf("expected an error encoding %#v", v)
+		}
+	}
+}
+
+func TestStructParams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("X-Query", r.URL.RawQuery)
+		w.Header().Set("X-Form", r.PostForm.Encode())
+		w.Header()["X-Tags"] = r.Header.Values("X-Tag")
+	}))
+	defer server.Close()
+
+	params := SearchParams{Query: "greq", Tags: []string{"a", "b"}, Internal: "secret"}
+
+	resp, err := greq.PostRequest(server.URL).
+		WithQueryParams(params).
+		WithHeaders(params).
+		WithUrlencodedFormBody(params, nil).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query := resp.Response.Header.Get("X-Query"); query != "Score=0&page=0&q=greq&tag=a&tag=b" {
+		t.Errorf("unexpected query %s", query)
+	}
+
+	if form := resp.Response.Header.Get("X-Form"); form != "Archived=&Score=0&Since=0001-01-01&Until=&page=0&q=greq&tags=a%2Cb" {
+		t.Errorf("unexpected form %s", form)
+	}
+
+	if tags := resp.Response.Header.Values("X-Tags"); len(tags) != 2 {
+		t.Errorf("unexpected header values %v", tags)
+	}
+
+	if err := greq.GetRequest(server.URL).WithQueryParams([]string{"a"}).Validate(); err == nil {
+		t.Error("expected an error for an unsupported query type")
+	}
+}
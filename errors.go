@@ -0,0 +1,188 @@
+package greq
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// The maximum number of bytes of the response body kept in an HTTPError
+const ErrorBodyLimit = 4 << 10
+
+// The number of bytes of the body included in the message of an HTTPError
+const errorMessageLimit = 256
+
+var (
+	// The request or the connection timed out
+	ErrTimeout = errors.New("greq: timeout")
+	// The TLS handshake failed, for example because the certificate is not trusted
+	ErrTLS = errors.New("greq: tls failure")
+	// The host name could not be resolved
+	ErrDNS = errors.New("greq: dns failure")
+)
+
+// Returned when a response has an unexpected status code
+type HTTPError struct {
+	StatusCode int
+	// The status line, for example "404 Not Found"
+	Status string
+	// The method and URL of the request, after redirects
+	Method string
+	URL    string
+
+	Headers http.Header
+	// The start of the decompressed response body, at most ErrorBodyLimit bytes
+	Body []byte
+	// Set when the body was longer than ErrorBodyLimit
+	Truncated bool
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.URL, e.Status)
+
+	// Only text bodies are included, shortened to a single line
+	if snippet := e.Body; len(snippet) > 0 && utf8.Valid(snippet) {
+		if len(snippet) > errorMessageLimit {
+			snippet = snippet[:errorMessageLimit]
+		}
+
+		msg += ": " + strings.Join(strings.Fields(string(snippet)), " ")
+	}
+
+	return msg
+}
+
+// Create an HTTPError for a response and the body that has been read from it
+func newHTTPError(resp *GResponse, body []byte) *HTTPError {
+	err := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Response.Status,
+		Headers:    resp.Response.Header,
+	}
+
+	if len(body) > ErrorBodyLimit {
+		body = body[:ErrorBodyLimit]
+		err.Truncated = true
+	}
+	err.Body = body
+
+	if req := resp.Response.Request; req != nil {
+		err.Method = req.Method
+		err.URL = req.URL.Redacted()
+	}
+
+	return err
+}
+
+// Read at most ErrorBodyLimit bytes of the body and close it
+// The body is only kept for the error, so read errors are ignored
+func (r *GResponse) errorBody() []byte {
+	body, err := r.decodedBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(body, ErrorBodyLimit+1))
+	return data
+}
+
+// Return an HTTPError if the status code is not one of the given codes
+// The body of a failed response is read into HTTPError.Body, the returned GResponse can
+// still be used to inspect the status and headers.
+func (g *GRequest) WithExpectStatus(codes ...int) *GRequest {
+	if len(codes) == 0 {
+		g.addError(errtools.MissingValueError("at least one status code is required"))
+		return g
+	}
+
+	g.expectStatus = func(statusCode int) bool {
+		for _, code := range codes {
+			if code == statusCode {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return g
+}
+
+// Return an HTTPError if the status code is not 2xx
+func (g *GRequest) EnsureSuccess() *GRequest {
+	g.expectStatus = isSuccess
+	return g
+}
+
+// An error from sending the request, matching the sentinels for its cause with errors.Is
+// The message is that of the original error, which is also available with errors.As
+type transportError struct {
+	err   error
+	kinds []error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() []error {
+	return append([]error{e.err}, e.kinds...)
+}
+
+// Wrap an error from the http client so it matches ErrTimeout, ErrTLS or ErrDNS
+func classifyError(err error) error {
+	var kinds []error
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		kinds = append(kinds, ErrTimeout)
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		kinds = append(kinds, ErrDNS)
+	}
+
+	if isTLSError(err) {
+		kinds = append(kinds, ErrTLS)
+	}
+
+	if len(kinds) == 0 {
+		return err
+	}
+
+	return &transportError{err: err, kinds: kinds}
+}
+
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		pinErr       *PinMismatchError
+		opErr        *net.OpError
+	)
+
+	switch {
+	case errors.As(err, &recordErr), errors.As(err, &verifyErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		errors.As(err, &pinErr):
+		return true
+	}
+
+	// Alerts sent by the server, for example when it rejects the client certificate
+	return errors.As(err, &opErr) && opErr.Op == "remote error" && strings.HasPrefix(opErr.Err.Error(), "tls: ")
+}
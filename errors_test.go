@@ -0,0 +1,146 @@
+package greq_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+// Respond to unknown paths with a JSON error and a request id
+func missingPet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Request-Id", "abc")
+	respond(http.StatusNotFound, "application/json", notFoundProblem)(w, r)
+}
+
+func TestExpectStatus(t *testing.T) {
+	server := newTestServer(t, routes{
+		"/ok": respond(http.StatusOK, "", "ok"),
+		"/":   missingPet,
+	})
+
+	// Without an expected status, any response is returned without an error
+	resp, err := greq.GetRequest(server.URL + "/missing").Execute()
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected result %v", err)
+	}
+	resp.Close()
+
+	resp, err = greq.GetRequest(server.URL + "/missing").EnsureSuccess().Execute()
+
+	var httpErr *greq.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the response to be returned with the error")
+	}
+
+	if httpErr.StatusCode != http.StatusNotFound || httpErr.Method != http.MethodGet || httpErr.URL != server.URL+"/missing" {
+		t.Errorf("unexpected error %+v", httpErr)
+	}
+
+	if httpErr.Headers.Get("X-Request-Id") != "abc" || string(httpErr.Body) != notFoundProblem || httpErr.Truncated {
+		t.Errorf("unexpected headers or body %v %q", httpErr.Headers, httpErr.Body)
+	}
+
+	if !strings.Contains(err.Error(), "404 Not Found") || !strings.Contains(err.Error(), "no such pet") {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	if _, err := greq.GetRequest(server.URL + "/ok").WithExpectStatus(http.StatusCreated).Execute(); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusOK {
+		t.Errorf("expected an HTTPError for 200, got %v", err)
+	}
+
+	resp, err = greq.GetRequest(server.URL+"/missing").WithExpectStatus(http.StatusOK, http.StatusNotFound).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyString(); !strings.Contains(body, "not_found") {
+		t.Errorf("expected the body to be readable, got %q", body)
+	}
+
+	if _, err := greq.GetRequest(server.URL + "/ok").WithExpectStatus().Execute(); err == nil {
+		t.Error("expected an error without status codes")
+	}
+}
+
+func TestHTTPErrorBodyLimit(t *testing.T) {
+	server := newTestServer(t, respond(http.StatusBadGateway, "", strings.Repeat("x", 3*greq.ErrorBodyLimit)))
+
+	_, err := greq.GetRequest(server.URL + "/large").EnsureSuccess().Execute()
+
+	var httpErr *greq.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+
+	if len(httpErr.Body) != greq.ErrorBodyLimit || !httpErr.Truncated {
+		t.Errorf("expected the body to be truncated, got %d bytes", len(httpErr.Body))
+	}
+
+	if len(err.Error()) > 512 {
+		t.Errorf("expected a short message, got %d bytes", len(err.Error()))
+	}
+}
+
+func TestDoWithErrorExpectStatus(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(missingPet))
+
+	_, apiErr, resp, err := greq.DoWithError[Pet, APIError](greq.GetRequest(server.URL + "/missing").EnsureSuccess())
+
+	var httpErr *greq.HTTPError
+	if !errors.As(err, &httpErr) || resp == nil {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+
+	if apiErr == nil || apiErr.Code != "not_found" {
+		t.Errorf("expected the error body to be decoded, got %+v", apiErr)
+	}
+}
+
+type failingResolver struct{}
+
+func (failingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestTransportErrors(t *testing.T) {
+	_, err := greq.GetRequest("http://missing.example/").WithResolver(failingResolver{}).Execute()
+	if !errors.Is(err, greq.ErrDNS) || errors.Is(err, greq.ErrTLS) {
+		t.Errorf("expected a DNS error, got %v", err)
+	}
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || dnsErr.Name != "missing.example" {
+		t.Errorf("expected the original error to be kept, got %v", err)
+	}
+
+	server, _ := newTLSTestServer()
+	defer server.Close()
+
+	if _, err := greq.GetRequest(server.URL).Execute(); !errors.Is(err, greq.ErrTLS) || errors.Is(err, greq.ErrDNS) {
+		t.Errorf("expected a TLS error, got %v", err)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	_, err = greq.GetRequest(slow.URL).WithClient(&http.Client{Timeout: 50 * time.Millisecond}).Execute()
+	if !errors.Is(err, greq.ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
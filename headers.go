@@ -0,0 +1,120 @@
+package greq
+
+import (
+	"net/http"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// The default user agent, used if no User-Agent header is set
+const defaultUserAgent = "Clysec GREQ/1.0"
+
+// The default Accept-Encoding, listing the content codings GResponse can decode
+const defaultAcceptEncoding = "gzip, deflate, br, zstd"
+
+// The headers of a request are kept in separate layers, and merged when the
+// request is executed. A header in a higher layer replaces all values for
+// the same header in the layers below it, from lowest to highest:
+// - defaults (User-Agent, Accept-Encoding)
+// - headers set by the body functions (Content-Type)
+// - headers set by authorizations (Authorization)
+// - headers set by the user with WithHeader, SetHeader and AddHeader
+// Headers removed with DelHeader are removed from all layers.
+type headerLayers struct {
+	body    http.Header
+	auth    http.Header
+	user    http.Header
+	deleted map[string]bool
+}
+
+// Set a header from one of the body functions
+func (g *GRequest) setBodyHeader(key, value string) {
+	if g.headers.body == nil {
+		g.headers.body = http.Header{}
+	}
+
+	g.headers.body.Set(key, value)
+}
+
+// Set a header from an authorization
+func (g *GRequest) setAuthHeader(key, value string) {
+	if g.headers.auth == nil {
+		g.headers.auth = http.Header{}
+	}
+
+	g.headers.auth.Set(key, value)
+}
+
+// Get the user header layer, restoring a header that was deleted
+func (g *GRequest) userHeaders(key string) http.Header {
+	if g.headers.user == nil {
+		g.headers.user = http.Header{}
+	}
+
+	delete(g.headers.deleted, http.CanonicalHeaderKey(key))
+
+	return g.headers.user
+}
+
+// Set a header on the request, replacing any existing values
+func (g *GRequest) SetHeader(key, value string) *GRequest {
+	if key == "" {
+		g.addError(errtools.InvalidKeyError("header key cannot be empty"))
+		return g
+	}
+
+	g.userHeaders(key).Set(key, value)
+	return g
+}
+
+// Add a value to a header on the request, keeping any existing values
+// This can be used to send repeated headers, such as multiple Accept or Cookie headers
+func (g *GRequest) AddHeader(key, value string) *GRequest {
+	if key == "" {
+		g.addError(errtools.InvalidKeyError("header key cannot be empty"))
+		return g
+	}
+
+	g.userHeaders(key).Add(key, value)
+	return g
+}
+
+// Remove a header from the request, including headers set by the body,
+// authorizations and defaults such as the User-Agent
+func (g *GRequest) DelHeader(key string) *GRequest {
+	canonical := http.CanonicalHeaderKey(key)
+
+	if g.headers.deleted == nil {
+		g.headers.deleted = make(map[string]bool)
+	}
+
+	g.headers.deleted[canonical] = true
+	g.headers.user.Del(canonical)
+
+	return g
+}
+
+// Merge the header layers into the headers to send
+func (h *headerLayers) merge() http.Header {
+	merged := http.Header{
+		"User-Agent":      {defaultUserAgent},
+		"Accept-Encoding": {defaultAcceptEncoding},
+	}
+
+	for _, layer := range []http.Header{h.body, h.auth, h.user} {
+		for k, v := range layer {
+			merged[k] = append([]string(nil), v...)
+		}
+	}
+
+	for k := range h.deleted {
+		merged.Del(k)
+	}
+
+	// net/http adds its own User-Agent unless the header is present and empty
+	if h.deleted["User-Agent"] {
+		merged["User-Agent"] = []string{""}
+	}
+
+	return merged
+}
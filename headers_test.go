@@ -0,0 +1,80 @@
+package greq_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+// Respond with the request headers as JSON
+func echoHeaders(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(r.Header)
+}
+
+func executeForHeaders(t *testing.T, request *greq.GRequest) http.Header {
+	t.Helper()
+
+	resp, err := request.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := http.Header{}
+	if err := resp.BodyUnmarshalJson(&headers); err != nil {
+		t.Fatal(err)
+	}
+
+	return headers
+}
+
+func TestMultiValueHeaders(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoHeaders))
+
+	headers := executeForHeaders(t, greq.GetRequest(server.URL).
+		AddHeader("accept", "application/json").
+		AddHeader("Accept", "text/plain").
+		WithHeaders(map[string]interface{}{"X-Forwarded-For": []string{"10.0.0.1", "10.0.0.2"}}))
+
+	if len(headers["Accept"]) != 2 || headers["Accept"][0] != "application/json" || headers["Accept"][1] != "text/plain" {
+		t.Errorf("unexpected Accept headers %v", headers["Accept"])
+	}
+
+	if len(headers["X-Forwarded-For"]) != 2 {
+		t.Errorf("unexpected X-Forwarded-For headers %v", headers["X-Forwarded-For"])
+	}
+}
+
+func TestHeaderPrecedence(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(echoHeaders))
+
+	// User headers win over body and auth headers, regardless of the order
+	headers := executeForHeaders(t, greq.PostRequest(server.URL).
+		WithHeader("content-type", "application/vnd.api+json").
+		WithJSONBody(map[string]string{"hello": "world"}, nil).
+		SetHeader("Authorization", "Token user").
+		WithAuth(&greq.BearerAuth{Token: "auth"}).
+		DelHeader("User-Agent"))
+
+	if len(headers["Content-Type"]) != 1 || headers.Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("unexpected Content-Type %v", headers["Content-Type"])
+	}
+
+	if headers.Get("Authorization") != "Token user" {
+		t.Errorf("unexpected Authorization %v", headers["Authorization"])
+	}
+
+	if _, ok := headers["User-Agent"]; ok {
+		t.Errorf("expected the User-Agent header to be removed, got %v", headers["User-Agent"])
+	}
+
+	// Auth headers win over body headers
+	headers = executeForHeaders(t, greq.PostRequest(server.URL).
+		WithAuth(&greq.HeaderAuth{Key: "Content-Type", Value: "text/auth"}).
+		WithStringBody("body"))
+
+	if headers.Get("Content-Type") != "text/auth" || headers.Get("User-Agent") == "" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+}
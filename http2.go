@@ -0,0 +1,117 @@
+package greq
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// The HTTP protocol version to use for a request
+type HTTPVersion string
+
+const (
+	// Use HTTP/2 if the server supports it over TLS, otherwise HTTP/1.1
+	HTTPAuto HTTPVersion = ""
+	// Always use HTTP/1.1
+	HTTP1 HTTPVersion = "HTTP/1.1"
+	// Always use HTTP/2 over TLS, failing if the server does not support it
+	HTTP2 HTTPVersion = "HTTP/2"
+	// Use HTTP/2 over cleartext with prior knowledge (h2c), for example for gRPC style backends
+	H2C HTTPVersion = "h2c"
+)
+
+// Set the HTTP protocol version to use
+// HTTP2 and H2C do not support proxies
+func (g *GRequest) WithHTTPVersion(version HTTPVersion) *GRequest {
+	switch version {
+	case HTTPAuto, HTTP1, HTTP2, H2C:
+		g.httpVersion = version
+	default:
+		g.addError(fmt.Errorf("invalid http version: %s", version))
+	}
+
+	return g
+}
+
+// Build the round tripper for the protocol version from a configured transport
+// The result is cached together with the transport it wraps, so an http2.Transport
+// and its connections are reused by requests with the same settings
+func (v HTTPVersion) transport(t *http.Transport) (http.RoundTripper, error) {
+	switch v {
+	case HTTPAuto:
+		return t, nil
+
+	case HTTP1:
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+		if t.TLSClientConfig != nil {
+			t.TLSClientConfig = t.TLSClientConfig.Clone()
+			t.TLSClientConfig.NextProtos = []string{"http/1.1"}
+		}
+
+		return t, nil
+
+	case HTTP2:
+		tlsConfig := &tls.Config{}
+		if t.TLSClientConfig != nil {
+			tlsConfig = t.TLSClientConfig.Clone()
+		}
+
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+
+		return &http2.Transport{
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: t.DisableCompression,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dialTransport(ctx, t, network, addr)
+				if err != nil {
+					return nil, err
+				}
+
+				// The server name is taken from the address unless it was overridden
+				if cfg.ServerName == "" {
+					cfg = cfg.Clone()
+					cfg.ServerName, _, _ = net.SplitHostPort(addr)
+				}
+
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+
+				if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+					tlsConn.Close()
+					return nil, fmt.Errorf("server does not support HTTP/2, negotiated protocol %q", proto)
+				}
+
+				return tlsConn, nil
+			},
+		}, nil
+
+	case H2C:
+		return &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: t.DisableCompression,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialTransport(ctx, t, network, addr)
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid http version: %s", v)
+}
+
+// Open a connection with the dial function of a transport
+func dialTransport(ctx context.Context, t *http.Transport, network, addr string) (net.Conn, error) {
+	if t.DialContext != nil {
+		return t.DialContext(ctx, network, addr)
+	}
+
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
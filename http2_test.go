@@ -0,0 +1,142 @@
+package greq_test
+
+import (
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/clysec/greq"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+}
+
+func TestHTTPVersionTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(protoHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	tests := map[greq.HTTPVersion]string{
+		greq.HTTP1: "HTTP/1.1",
+		greq.HTTP2: "HTTP/2.0",
+	}
+
+	for version, expected := range tests {
+		resp, err := greq.GetRequest(server.URL).
+			WithTLSConfig(greq.TLSOptions{RootCAs: pool}).
+			WithHTTPVersion(version).
+			Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := resp.BodyString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Protocol != expected || body != expected {
+			t.Errorf("%s: expected protocol %s, got %s (server saw %s)", version, expected, resp.Protocol, body)
+		}
+	}
+}
+
+func TestHTTPVersionForceHTTP2Unsupported(t *testing.T) {
+	server := httptest.NewTLSServer(protoHandler())
+	defer server.Close()
+
+	_, err := greq.GetRequest(server.URL).TlsSetNovalidate().WithHTTPVersion(greq.HTTP2).Execute()
+	if err == nil {
+		t.Fatal("expected an error when the server does not support HTTP/2")
+	}
+}
+
+func TestHTTPVersionH2C(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(protoHandler(), &http2.Server{}))
+	defer server.Close()
+
+	resp, err := greq.GetRequest(server.URL).WithHTTPVersion(greq.H2C).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Protocol != "HTTP/2.0" || body != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2.0, got %s (server saw %s)", resp.Protocol, body)
+	}
+}
+
+// Count the connections opened to a server
+func countConnections(server *httptest.Server) *atomic.Int32 {
+	count := &atomic.Int32{}
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			count.Add(1)
+		}
+	}
+
+	return count
+}
+
+func TestHTTPVersionConnectionReuse(t *testing.T) {
+	tlsServer := httptest.NewUnstartedServer(protoHandler())
+	tlsServer.EnableHTTP2 = true
+	tlsConnections := countConnections(tlsServer)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsServer.Certificate())
+
+	h2cServer := httptest.NewUnstartedServer(h2c.NewHandler(protoHandler(), &http2.Server{}))
+	h2cConnections := countConnections(h2cServer)
+	h2cServer.Start()
+	defer h2cServer.Close()
+
+	tests := map[greq.HTTPVersion]func() (*greq.GRequest, *atomic.Int32){
+		greq.HTTP2: func() (*greq.GRequest, *atomic.Int32) {
+			return greq.GetRequest(tlsServer.URL).WithTLSConfig(greq.TLSOptions{RootCAs: pool}), tlsConnections
+		},
+		greq.H2C: func() (*greq.GRequest, *atomic.Int32) {
+			return greq.GetRequest(h2cServer.URL), h2cConnections
+		},
+	}
+
+	for version, newRequest := range tests {
+		var connections *atomic.Int32
+
+		for i := 0; i < 10; i++ {
+			var req *greq.GRequest
+			req, connections = newRequest()
+
+			resp, err := req.WithHTTPVersion(version).Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if body, err := resp.BodyString(); err != nil || body != "HTTP/2.0" {
+				t.Fatalf("%s: unexpected response %s %v", version, body, err)
+			}
+		}
+
+		if n := connections.Load(); n != 1 {
+			t.Errorf("%s: expected one connection to be reused, got %d connections", version, n)
+		}
+	}
+}
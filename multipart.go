@@ -104,13 +104,26 @@ func (m *MultipartField) WithFile(file *os.File, contentType *string) *Multipart
 }
 
 func (m *MultipartField) AddToWriter(w *multipart.Writer) error {
+	_, err := m.copyToWriter(w)
+	return err
+}
+
+// Add the field to the writer, returning the length of the field content
+func (m *MultipartField) copyToWriter(w *multipart.Writer) (int64, error) {
 	if x, ok := m.value.(io.Closer); ok {
 		defer x.Close()
 	}
 
-	var fw io.Writer
-	var err error
+	fw, err := m.createPart(w)
+	if err != nil {
+		return 0, err
+	}
+
+	return io.Copy(fw, m.value)
+}
 
+// Create the part for the field, with a header for the filename and content type if they are set
+func (m *MultipartField) createPart(w *multipart.Writer) (io.Writer, error) {
 	if m.filename != nil || m.contentType != nil {
 		partHeader := textproto.MIMEHeader{}
 
@@ -123,18 +136,8 @@ func (m *MultipartField) AddToWriter(w *multipart.Writer) error {
 			partHeader.Add("Content-Type", *m.contentType)
 		}
 
-		fw, err = w.CreatePart(partHeader)
-	} else {
-		fw, err = w.CreateFormField(m.Key)
-	}
-
-	if err != nil {
-		return err
-	}
-
-	if _, err := io.Copy(fw, m.value); err != nil {
-		return err
+		return w.CreatePart(partHeader)
 	}
 
-	return nil
+	return w.CreateFormField(m.Key)
 }
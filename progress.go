@@ -0,0 +1,198 @@
+package greq
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// The default minimum time between two progress reports
+const DefaultProgressInterval = 100 * time.Millisecond
+
+// The progress of a request or response body transfer
+type Progress struct {
+	// The number of bytes transferred so far
+	Transferred int64
+	// The size of the body, or -1 if it is unknown
+	Total int64
+	// The average transfer rate in bytes per second
+	Rate float64
+	// The time since the transfer started
+	Elapsed time.Duration
+	// The estimated time until the transfer is done, or -1 if it is unknown
+	ETA time.Duration
+	// Set on the last report, when the whole body has been transferred
+	Done bool
+
+	// The multipart field that is being sent, nil for other bodies
+	Part *PartProgress
+}
+
+// The progress of a single multipart field
+type PartProgress struct {
+	Name string
+	// The number of bytes of the field content transferred so far
+	Transferred int64
+	// The size of the field content, or -1 if it is unknown
+	Total int64
+}
+
+// Called with the progress of a body transfer
+// The function is called from the goroutine reading the body, and should return quickly
+type ProgressFunc func(Progress)
+
+// The position of a multipart field in the body
+type bodyPart struct {
+	name   string
+	start  int64
+	length int64
+}
+
+// The minimum time between two progress reports
+func (g *GRequest) progressInterval() time.Duration {
+	if g.progressEvery <= 0 {
+		return DefaultProgressInterval
+	}
+
+	return g.progressEvery
+}
+
+// Report the progress of the request body upload
+// For multipart bodies the progress of the current field is included in Progress.Part
+func (g *GRequest) WithUploadProgress(fn ProgressFunc) *GRequest {
+	g.uploadProgress = fn
+	return g
+}
+
+// Report the progress of the response body download
+// The progress is reported while the body is read with the GResponse body functions
+func (g *GRequest) WithDownloadProgress(fn ProgressFunc) *GRequest {
+	g.downloadProgress = fn
+	return g
+}
+
+// Set the minimum time between two progress reports, defaults to DefaultProgressInterval
+// The last report, with Done set, is always sent
+func (g *GRequest) WithProgressInterval(interval time.Duration) *GRequest {
+	g.progressEvery = interval
+	return g
+}
+
+// Wrap the body so the progress is reported every time it is opened
+func (b *requestBody) withProgress(fn ProgressFunc, interval time.Duration) *requestBody {
+	wrapped := *b
+	wrapped.open = func() (io.ReadCloser, error) {
+		body, err := b.open()
+		if err != nil {
+			return nil, err
+		}
+
+		return newProgressReader(body, b.length, b.parts, fn, interval), nil
+	}
+
+	return &wrapped
+}
+
+// Reports the progress of reading the wrapped body
+type progressReader struct {
+	body     io.ReadCloser
+	total    int64
+	parts    []bodyPart
+	fn       ProgressFunc
+	interval time.Duration
+
+	mu          sync.Mutex
+	transferred int64
+	start       time.Time
+	lastReport  time.Time
+	done        bool
+}
+
+func newProgressReader(body io.ReadCloser, total int64, parts []bodyPart, fn ProgressFunc, interval time.Duration) *progressReader {
+	now := time.Now()
+
+	return &progressReader{
+		body:       body,
+		total:      total,
+		parts:      parts,
+		fn:         fn,
+		interval:   interval,
+		start:      now,
+		lastReport: now,
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.body.Read(b)
+
+	p.mu.Lock()
+	p.transferred += int64(n)
+
+	now := time.Now()
+	report := false
+
+	// The body is done at EOF, or when the known length has been read, as
+	// decoders can stop reading before they get EOF
+	if !p.done && (err == io.EOF || (p.total >= 0 && n > 0 && p.transferred >= p.total)) {
+		p.done = true
+		report = true
+	} else if n > 0 && now.Sub(p.lastReport) >= p.interval {
+		report = true
+	}
+
+	var progress Progress
+	if report {
+		p.lastReport = now
+		progress = p.progress(now)
+	}
+	p.mu.Unlock()
+
+	if report {
+		p.fn(progress)
+	}
+
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	return p.body.Close()
+}
+
+// Calculate the progress, must be called with the lock held
+func (p *progressReader) progress(now time.Time) Progress {
+	progress := Progress{
+		Transferred: p.transferred,
+		Total:       p.total,
+		Elapsed:     now.Sub(p.start),
+		ETA:         -1,
+		Done:        p.done,
+	}
+
+	if progress.Elapsed > 0 {
+		progress.Rate = float64(p.transferred) / progress.Elapsed.Seconds()
+	}
+
+	if p.done {
+		progress.ETA = 0
+	} else if p.total >= 0 && progress.Rate > 0 {
+		progress.ETA = time.Duration(float64(p.total-p.transferred) / progress.Rate * float64(time.Second))
+	}
+
+	// The current part is the last one that has started
+	for i := len(p.parts) - 1; i >= 0; i-- {
+		part := p.parts[i]
+		if part.start > p.transferred {
+			continue
+		}
+
+		transferred := p.transferred - part.start
+		if part.length >= 0 && transferred > part.length {
+			transferred = part.length
+		}
+
+		progress.Part = &PartProgress{Name: part.name, Transferred: transferred, Total: part.length}
+		break
+	}
+
+	return progress
+}
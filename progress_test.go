@@ -0,0 +1,147 @@
+package greq_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+func collectProgress(reports *[]greq.Progress) greq.ProgressFunc {
+	return func(p greq.Progress) {
+		*reports = append(*reports, p)
+	}
+}
+
+func checkProgress(t *testing.T, name string, reports []greq.Progress, total int64) {
+	t.Helper()
+
+	if len(reports) == 0 {
+		t.Fatalf("%s: no progress reported", name)
+	}
+
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Transferred < reports[i-1].Transferred {
+			t.Errorf("%s: progress went backwards: %d after %d", name, reports[i].Transferred, reports[i-1].Transferred)
+		}
+	}
+
+	last := reports[len(reports)-1]
+	if !last.Done || last.Transferred != total || last.Total != total || last.ETA != 0 {
+		t.Errorf("%s: unexpected final progress %+v", name, last)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	payload := bytes.Repeat([]byte("greq"), 64*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	var uploads, downloads []greq.Progress
+
+	resp, err := greq.PostRequest(server.URL).
+		WithByteBody(payload).
+		WithUploadProgress(collectProgress(&uploads)).
+		WithDownloadProgress(collectProgress(&downloads)).
+		WithProgressInterval(time.Nanosecond).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body) != len(payload) {
+		t.Errorf("unexpected body length %d", len(body))
+	}
+
+	checkProgress(t, "upload", uploads, int64(len(payload)))
+	checkProgress(t, "download", downloads, int64(len(payload)))
+
+	if len(downloads) < 2 {
+		t.Errorf("expected multiple download reports, got %d", len(downloads))
+	}
+
+	// With the default interval a fast transfer only reports when it is done
+	var throttled []greq.Progress
+
+	_, err = greq.PostRequest(server.URL).
+		WithByteBody(payload).
+		WithUploadProgress(collectProgress(&throttled)).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(throttled) > 2 {
+		t.Errorf("expected the reports to be throttled, got %d", len(throttled))
+	}
+}
+
+func TestMultipartProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	first := strings.Repeat("a", 128*1024)
+	second := strings.Repeat("b", 128*1024)
+
+	fields := func() []*greq.MultipartField {
+		return []*greq.MultipartField{
+			greq.NewMultipartField("first").WithStringValue(first),
+			greq.NewMultipartField("second").WithFilename("second.txt").WithStringValue(second),
+		}
+	}
+
+	requests := map[string]*greq.GRequest{
+		"buffered":  greq.PostRequest(server.URL).WithMultipartFormBody(fields()),
+		"streaming": greq.PostRequest(server.URL).WithStreamingMultipartFormBody(fields()),
+	}
+
+	for name, request := range requests {
+		var reports []greq.Progress
+
+		_, err := request.
+			WithUploadProgress(collectProgress(&reports)).
+			WithProgressInterval(time.Nanosecond).
+			Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := map[string]bool{}
+		for _, report := range reports {
+			if report.Part != nil {
+				seen[report.Part.Name] = true
+
+				if report.Part.Transferred > report.Part.Total {
+					t.Errorf("%s: part progress exceeds its size: %+v", name, report.Part)
+				}
+			}
+		}
+
+		if !seen["first"] || !seen["second"] {
+			t.Errorf("%s: expected progress for both parts, got %v", name, seen)
+		}
+
+		last := reports[len(reports)-1]
+		if !last.Done || last.Part == nil || last.Part.Name != "second" || last.Part.Transferred != int64(len(second)) {
+			t.Errorf("%s: unexpected final progress %+v %+v", name, last, last.Part)
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package greq
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/scheiblingco/gofn/errtools"
 	"github.com/scheiblingco/gofn/typetools"
@@ -16,22 +16,92 @@ import (
 type Method string
 
 const (
-	GET    Method = "GET"
-	POST   Method = "POST"
-	PUT    Method = "PUT"
-	PATCH  Method = "PATCH"
-	DELETE Method = "DELETE"
+	GET     Method = "GET"
+	POST    Method = "POST"
+	PUT     Method = "PUT"
+	PATCH   Method = "PATCH"
+	DELETE  Method = "DELETE"
+	HEAD    Method = "HEAD"
+	OPTIONS Method = "OPTIONS"
+	TRACE   Method = "TRACE"
+	CONNECT Method = "CONNECT"
 )
 
+// Whether a method can have a request body
+type bodyRule int
+
+const (
+	bodyAllowed bodyRule = iota
+	// The body has no defined meaning for the method, and is only sent if AllowBody is called
+	bodyDiscouraged
+	// The body is never sent for the method
+	bodyForbidden
+)
+
+// Body rules for the standard methods, other methods accept a body
+var methodBodyRules = map[Method]bodyRule{
+	GET:     bodyDiscouraged,
+	HEAD:    bodyDiscouraged,
+	DELETE:  bodyDiscouraged,
+	TRACE:   bodyForbidden,
+	CONNECT: bodyForbidden,
+}
+
+// Check if the method is a valid token according to RFC 9110
+// This allows custom methods such as PROPFIND, PURGE or QUERY
+func (m Method) Valid() bool {
+	if m == "" {
+		return false
+	}
+
+	for _, c := range m {
+		if c > 127 || !isTokenChar(byte(c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
 // The HTTP Request to be made
 type GRequest struct {
 	Url    string
 	Method Method
 
-	client  *http.Client
-	headers map[string]string
-	query   *url.Values
-	body    io.Reader
+	client     *http.Client
+	headers    headerLayers
+	query      *url.Values
+	pathParams map[string]interface{}
+	cookies    []*http.Cookie
+	body       *requestBody
+
+	tlsOptions  *TLSOptions
+	dial        *dialOptions
+	httpVersion HTTPVersion
+
+	encoder   *Encoder
+	allowBody bool
+
+	uploadProgress   ProgressFunc
+	downloadProgress ProgressFunc
+	progressEvery    time.Duration
+	uploadLimiters   []*RateLimiter
+	downloadLimiters []*RateLimiter
+
+	compression          Compression
+	compressionThreshold int64
+
+	expectStatus func(statusCode int) bool
+
+	ctx context.Context
 
 	errs []error
 }
@@ -42,13 +112,18 @@ func (g *GRequest) addError(err error) {
 	g.errs = append(g.errs, err)
 }
 
-// Add a header to the request
-func (g *GRequest) addHeader(key, value string) {
-	if g.headers == nil {
-		g.headers = make(map[string]string)
+// Add a query parameter to the request
+func (g *GRequest) addQuery(key, value string) {
+	if g.query == nil {
+		g.query = &url.Values{}
 	}
 
-	g.headers[key] = value
+	g.query.Add(key, value)
+}
+
+// Add a cookie to the request
+func (g *GRequest) addCookie(cookie *http.Cookie) {
+	g.cookies = append(g.cookies, cookie)
 }
 
 // Add a custom transport to the http client
@@ -60,33 +135,88 @@ func (g *GRequest) addTransport(transport http.RoundTripper) {
 	}
 }
 
-// Check if a body is accepted for the request
-func (g *GRequest) bodyAccepted() {
-	if g.Method == GET || g.Method == DELETE {
-		g.addError(errtools.BodyNotAcceptedError("cannot have a body with a GET or DELETE request"))
-	}
+// Allow a body for methods where it has no defined meaning (GET, HEAD and DELETE)
+// Some APIs, for example search engines, expect a body with GET requests
+func (g *GRequest) AllowBody() *GRequest {
+	g.allowBody = true
+	return g
 }
 
 // Ignore TLS Certificate Errors
 func (g *GRequest) TlsSetNovalidate() *GRequest {
+	if g.tlsOptions == nil {
+		g.tlsOptions = &TLSOptions{}
+	}
+
+	g.tlsOptions.InsecureSkipVerify = true
+
+	return g
+}
+
+// Set the TLS options for the request
+// The options are applied when the request is executed, on top of the transport
+// from the client or authorizations, so they can be combined with client certificates.
+// InsecureSkipVerify is kept if TlsSetNovalidate has already been called
+func (g *GRequest) WithTLSConfig(options TLSOptions) *GRequest {
+	if g.tlsOptions != nil && g.tlsOptions.InsecureSkipVerify {
+		options.InsecureSkipVerify = true
+	}
+
+	g.tlsOptions = &options
+
+	return g
+}
+
+// Get the client for the request, with the request level transport settings applied
+// The client passed to WithClient is not modified. Transports are shared between requests
+// with the same settings, shared is false if the transport was built for this request only.
+func (g *GRequest) buildClient() (client *http.Client, shared bool, err error) {
 	if g.client == nil {
 		g.client = &http.Client{}
 	}
 
-	if g.client.Transport == nil {
-		g.client.Transport = http.DefaultTransport
+	settings := []func(t *http.Transport) error{}
+
+	if g.tlsOptions != nil {
+		settings = append(settings, g.tlsOptions.apply)
+	}
+
+	if g.dial != nil {
+		settings = append(settings, g.dial.apply)
 	}
 
-	switch vt := g.client.Transport.(type) {
-	case *http.Transport:
-		vt.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	case http.RoundTripper:
-		g.client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+	if len(settings) == 0 && g.httpVersion == HTTPAuto {
+		return g.client, true, nil
 	}
 
-	return g
+	build := func() (http.RoundTripper, error) {
+		return rebuildTransport(g.client.Transport, func(t *http.Transport) (http.RoundTripper, error) {
+			for _, apply := range settings {
+				if err := apply(t); err != nil {
+					return nil, err
+				}
+			}
+
+			return g.httpVersion.transport(t)
+		})
+	}
+
+	var transport http.RoundTripper
+	if key, ok := g.transportKey(); ok {
+		transport, err = transports.get(key, build)
+		shared = true
+	} else {
+		transport, err = build()
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	built := *g.client
+	built.Transport = transport
+
+	return &built, shared, nil
 }
 
 // Add a custom HTTP client to the request
@@ -103,6 +233,18 @@ func (g *GRequest) WithClient(client *http.Client) *GRequest {
 	return g
 }
 
+// Use a context for the request, cancelling it cancels the request and
+// any throttled transfer of the body
+func (g *GRequest) WithContext(ctx context.Context) *GRequest {
+	if ctx == nil {
+		g.addError(errtools.MissingValueError("context cannot be nil"))
+		return g
+	}
+
+	g.ctx = ctx
+	return g
+}
+
 // // Add authentication to the request
 // // An Authorization type can be passed to multiple requests,
 // // which is useful in the case of Oauth2 or other token-based requests
@@ -112,19 +254,49 @@ func (g *GRequest) WithAuth(auth Authorization) *GRequest {
 		g.addError(err)
 	}
 
-	if err := auth.Apply(g.addHeader, g.addTransport); err != nil {
+	target := &AuthTarget{
+		AddHeader:    g.setAuthHeader,
+		AddQuery:     g.addQuery,
+		AddCookie:    g.addCookie,
+		SetTransport: g.addTransport,
+	}
+
+	// Path parameters may be added after the auth, so the URL is only
+	// expanded if the template can already be expanded
+	authUrl := g.Url
+	if g.isTemplate() {
+		if expanded, err := expandTemplate(g.Url, g.pathParams); err == nil {
+			authUrl = expanded
+		}
+	}
+
+	if u, err := url.Parse(authUrl); err == nil {
+		target.URL = u
+	}
+
+	if err := applyAuth(auth, target); err != nil {
 		g.addError(err)
 	}
 
 	return g
 }
 
-// Add a header to the request
-// Headers are added before the body functions, meaning if you add a
-// content-type header and then add a form body, the request header will
-// be overridden.
-// You can manually include a content-type header in the call to all functions
-// that modify the header.
+// Add a cookie to the request
+func (g *GRequest) WithCookie(cookie *http.Cookie) *GRequest {
+	if cookie == nil || cookie.Name == "" {
+		g.addError(errtools.InvalidKeyError("cookie name cannot be empty"))
+		return g
+	}
+
+	g.addCookie(cookie)
+
+	return g
+}
+
+// Set a header on the request
+// Headers set with WithHeader take precedence over headers set by the body
+// functions and authorizations, regardless of the order they are called in.
+// This means you can override the content-type of a body with WithHeader.
 func (g *GRequest) WithHeader(key string, value interface{}) *GRequest {
 	if key == "" {
 		g.addError(errtools.InvalidKeyError("header key cannot be empty"))
@@ -136,7 +308,7 @@ func (g *GRequest) WithHeader(key string, value interface{}) *GRequest {
 			g.addError(errtools.InvalidFieldError("header value cannot be empty"))
 		}
 
-		g.addHeader(key, stv)
+		g.userHeaders(key).Set(key, stv)
 	} else {
 		g.addError(errtools.InvalidTypeError("header value must be a string or string-like type"))
 	}
@@ -144,16 +316,21 @@ func (g *GRequest) WithHeader(key string, value interface{}) *GRequest {
 	return g
 }
 
-// Add multiple headers to the request
-// Any string-like object can be passed as a value, and it will be converted to a string automatically
-func (g *GRequest) WithHeaders(headers map[string]interface{}) *GRequest {
-	for k, v := range headers {
-		if typetools.IsStringlikeType(v) || typetools.IsNumericType(v) {
-			g.addHeader(k, typetools.EnsureString(v))
-		} else if val, ok := v.(bool); ok {
-			g.addHeader(k, fmt.Sprintf("%t", val))
-		} else {
-			g.addError(errtools.InvalidTypeError(fmt.Sprintf("header value for %s must be a string or string-like type", k)))
+// Set multiple headers on the request
+// Accepts a map with string keys or a struct with `header:"..."` tags, see Encoder.
+// Any string-like object can be passed as a value, and it will be converted to a string automatically.
+// A slice sets multiple values for the header
+func (g *GRequest) WithHeaders(headers interface{}) *GRequest {
+	values, err := g.getEncoder().Encode(headers, "header")
+	if err != nil {
+		g.addError(err)
+		return g
+	}
+
+	for k, v := range values {
+		g.userHeaders(k).Del(k)
+		for _, v2 := range v {
+			g.userHeaders(k).Add(k, v2)
 		}
 	}
 
@@ -161,67 +338,44 @@ func (g *GRequest) WithHeaders(headers map[string]interface{}) *GRequest {
 }
 
 func (g *GRequest) WithQueryParam(key, value string) *GRequest {
-	if g.query == nil {
-		g.query = &url.Values{}
-	}
-
-	g.query.Add(key, value)
+	g.addQuery(key, value)
 
 	return g
 }
 
 // Add query parameters to the request
+// Accepts url.Values, a map with string keys or a struct with `query:"..."` tags, see Encoder.
+// Map values can be scalars (strings, numbers, booleans, times), pointers to scalars or slices of scalars.
 func (g *GRequest) WithQueryParams(params interface{}) *GRequest {
-	if g.query == nil {
-		g.query = &url.Values{}
+	values, err := g.getEncoder().Encode(params, "query")
+	if err != nil {
+		g.addError(err)
+		return g
 	}
 
-	switch val := params.(type) {
-	case url.Values:
-		for k, v := range val {
-			for _, v2 := range v {
-				g.query.Add(k, v2)
-			}
-		}
-
-	case map[string]string:
-		for k, v := range val {
-			g.query.Add(k, v)
+	for k, v := range values {
+		for _, v2 := range v {
+			g.addQuery(k, v2)
 		}
+	}
 
-	case map[string][]string:
-		for k, v := range val {
-			for _, v2 := range v {
-				g.query.Add(k, v2)
-			}
-		}
+	return g
+}
 
-	case map[string][]byte:
-		for k, v := range val {
-			g.query.Add(k, string(v))
-		}
+// Set the encoder used for query parameters, headers and form bodies
+// Values are encoded when they are added, so this must be called before
+// WithQueryParams, WithHeaders and WithUrlencodedFormBody
+func (g *GRequest) WithEncoder(encoder *Encoder) *GRequest {
+	g.encoder = encoder
+	return g
+}
 
-	case map[string]interface{}:
-		for k, v := range val {
-			if typetools.IsStringlikeType(v) || typetools.IsNumericType(v) {
-				g.query.Add(k, typetools.EnsureString(v))
-			} else {
-				if vt, ok := v.([]string); ok {
-					for _, v2 := range vt {
-						g.query.Add(k, v2)
-					}
-				} else if vt, ok := v.(bool); ok {
-					g.query.Add(k, fmt.Sprintf("%t", vt))
-				} else {
-					g.addError(errtools.InvalidTypeError(fmt.Sprintf("field %s - form value must be a string, string slice, or string-like type", k)))
-				}
-			}
-		}
-	default:
-		g.addError(errtools.InvalidTypeError("query params must be a map[string]string, map[string][]string, map[string][]byte, map[string]interface{}, or url.Values"))
+func (g *GRequest) getEncoder() *Encoder {
+	if g.encoder == nil {
+		return NewEncoder()
 	}
 
-	return g
+	return g.encoder
 }
 
 // Validate the request to ensure no errors have popped up during creation
@@ -234,70 +388,161 @@ func (g *GRequest) Validate() error {
 		return errtools.InvalidFieldError("url cannot be empty")
 	}
 
-	if g.Method == "" || !strings.Contains("GETPOSTPUTDELETEPATCH", string(g.Method)) {
-		return errtools.InvalidFieldError("method must be one of GET, POST, PUT, DELETE, or PATCH")
+	if g.isTemplate() {
+		if _, err := expandTemplate(g.Url, g.pathParams); err != nil {
+			return err
+		}
+	}
+
+	if !g.Method.Valid() {
+		return errtools.InvalidFieldError(fmt.Sprintf("method %q is not a valid http method", g.Method))
+	}
+
+	if g.body != nil {
+		switch methodBodyRules[g.Method] {
+		case bodyForbidden:
+			return errtools.BodyNotAcceptedError(fmt.Sprintf("cannot have a body with a %s request", g.Method))
+		case bodyDiscouraged:
+			if !g.allowBody {
+				return errtools.BodyNotAcceptedError(fmt.Sprintf("cannot have a body with a %s request, call AllowBody to send it anyway", g.Method))
+			}
+		}
 	}
 
 	return nil
 }
 
+// Build the URL to send the request to, expanding the URI template
+// and adding the query parameters
+func (g *GRequest) requestURL() (string, error) {
+	requestUrl := g.Url
+
+	if g.isTemplate() {
+		expanded, err := expandTemplate(requestUrl, g.pathParams)
+		if err != nil {
+			return "", err
+		}
+
+		requestUrl = expanded
+	}
+
+	if g.query != nil && len(*g.query) != 0 {
+		if strings.Contains(requestUrl, "?") {
+			requestUrl += "&"
+		} else {
+			requestUrl += "?"
+		}
+
+		requestUrl += g.query.Encode()
+	}
+
+	return requestUrl, nil
+}
+
 // TODO: Proxy from environment
 // TODO: Timeout(s)
 // TODO: Redirects
-// TODO: Force attempt HTTP/2
 func (g *GRequest) Execute() (*GResponse, error) {
 	if err := g.Validate(); err != nil {
 		return nil, err
 	}
 
-	if g.query != nil && len(*g.query) != 0 {
-		if strings.Contains(g.Url, "?") {
-			g.Url += "&"
-		} else {
-			g.Url += "?"
-		}
+	requestUrl, err := g.requestURL()
+	if err != nil {
+		return nil, err
+	}
 
-		g.Url += g.query.Encode()
+	requestUrl, socket, err := splitUnixURL(requestUrl)
+	if err != nil {
+		return nil, err
 	}
 
-	userAgentFound := false
-	for k := range g.headers {
-		if strings.ToLower(k) == "user-agent" {
-			userAgentFound = true
-			break
-		}
+	if socket != "" {
+		g.dialOptions().unixSocket = socket
 	}
 
-	if !userAgentFound {
-		g.addHeader("User-Agent", "Clysec GREQ/1.0")
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	req, err := http.NewRequest(string(g.Method), g.Url, g.body)
+	req, err := http.NewRequestWithContext(ctx, string(g.Method), requestUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	if g.headers != nil {
-		for k, v := range g.headers {
-			req.Header.Add(k, v)
-		}
+	// The client is built before the body is opened, since opening a streaming or
+	// compressed body starts a goroutine that only ends when the body is closed
+	client, shared, err := g.buildClient()
+	if err != nil {
+		return nil, err
 	}
 
-	if g.client == nil {
-		g.client = &http.Client{}
+	// Progress is reported on the uncompressed body, and the limits apply to the bytes that are sent
+	body := g.body
+	if body != nil && g.uploadProgress != nil {
+		body = body.withProgress(g.uploadProgress, g.progressInterval())
 	}
 
-	resp, err := g.client.Do(req)
-	if err != nil {
+	compress := g.compressBody(body)
+	if compress {
+		body = body.withCompression(g.compression)
+	}
+
+	if body != nil && len(g.uploadLimiters) > 0 {
+		body = body.withLimiters(ctx, g.uploadLimiters)
+	}
+
+	if err := body.apply(req); err != nil {
 		return nil, err
 	}
 
-	return &GResponse{
+	req.Header = g.headers.merge()
+	if compress {
+		req.Header.Set("Content-Encoding", string(g.compression))
+	}
+
+	for _, c := range g.cookies {
+		req.AddCookie(c)
+	}
+
+	// The body is closed by the client from here on, even if the request fails
+	resp, err := client.Do(req)
+	g.body.done()
+
+	if !shared {
+		if err != nil {
+			closeIdleConnections(client.Transport)
+		} else {
+			resp.Body = &closeIdleBody{ReadCloser: resp.Body, transport: client.Transport}
+		}
+	}
+
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	if len(g.downloadLimiters) > 0 {
+		resp.Body = newThrottledReader(ctx, resp.Body, g.downloadLimiters)
+	}
+
+	if g.downloadProgress != nil {
+		resp.Body = newProgressReader(resp.Body, resp.ContentLength, nil, g.downloadProgress, g.progressInterval())
+	}
+
+	response := &GResponse{
 		StatusCode: resp.StatusCode,
+		Protocol:   resp.Proto,
 		Headers:    resp.Header,
 		Response:   resp,
 		bodyRead:   false,
-	}, nil
+	}
+
+	if g.expectStatus != nil && !g.expectStatus(resp.StatusCode) {
+		return response, newHTTPError(response, response.errorBody())
+	}
+
+	return response, nil
 }
 
 func NewRequest(method Method, url string) *GRequest {
@@ -326,3 +571,15 @@ func DeleteRequest(url string) *GRequest {
 func PatchRequest(url string) *GRequest {
 	return NewRequest(PATCH, url)
 }
+
+func HeadRequest(url string) *GRequest {
+	return NewRequest(HEAD, url)
+}
+
+func OptionsRequest(url string) *GRequest {
+	return NewRequest(OPTIONS, url)
+}
+
+func TraceRequest(url string) *GRequest {
+	return NewRequest(TRACE, url)
+}
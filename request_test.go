@@ -2,6 +2,8 @@ package greq_test
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/clysec/greq"
@@ -77,3 +79,61 @@ func TestGetRequest(t *testing.T) {
 		t.Fatalf("Unexpected Authorization header: %s", body.Headers["Authorization"])
 	}
 }
+
+func TestMethods(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	}))
+	defer server.Close()
+
+	requests := map[string]*greq.GRequest{
+		"HEAD":     greq.HeadRequest(server.URL),
+		"OPTIONS":  greq.OptionsRequest(server.URL),
+		"TRACE":    greq.TraceRequest(server.URL),
+		"PROPFIND": greq.NewRequest("PROPFIND", server.URL),
+		"QUERY":    greq.NewRequest("QUERY", server.URL).WithStringBody("select *"),
+		"GET":      greq.GetRequest(server.URL).AllowBody().WithJSONBody(map[string]string{"query": "match"}, nil),
+	}
+
+	for method, request := range requests {
+		resp, err := request.Execute()
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		resp.Close()
+
+		if resp.Headers["X-Method"][0] != method {
+			t.Errorf("expected method %s, got %s", method, resp.Headers["X-Method"][0])
+		}
+	}
+}
+
+func TestMethodValidation(t *testing.T) {
+	invalid := []*greq.GRequest{
+		greq.NewRequest("TPO GET", "http://localhost"),
+		greq.NewRequest("", "http://localhost"),
+		greq.NewRequest("GET\n", "http://localhost"),
+		greq.GetRequest("http://localhost").WithStringBody("body"),
+		greq.DeleteRequest("http://localhost").WithStringBody("body"),
+		greq.TraceRequest("http://localhost").AllowBody().WithStringBody("body"),
+	}
+
+	for _, request := range invalid {
+		if err := request.Validate(); err == nil {
+			t.Errorf("expected %q to fail validation", request.Method)
+		}
+	}
+
+	valid := []*greq.GRequest{
+		greq.NewRequest("TPO", "http://localhost"),
+		greq.NewRequest("M-SEARCH", "http://localhost"),
+		greq.DeleteRequest("http://localhost").AllowBody().WithStringBody("body"),
+		greq.OptionsRequest("http://localhost").WithStringBody("body"),
+	}
+
+	for _, request := range valid {
+		if err := request.Validate(); err != nil {
+			t.Errorf("expected %q to pass validation: %v", request.Method, err)
+		}
+	}
+}
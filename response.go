@@ -15,10 +15,37 @@ type GResponse struct {
 	Headers    map[string][]string
 	Response   *http.Response
 
+	// The negotiated protocol, for example HTTP/1.1 or HTTP/2.0
+	Protocol string
+
 	bodyRead bool
 }
 
+// Mark the body as read and return it, decoded based on the Content-Encoding header
+func (r *GResponse) decodedBody() (io.ReadCloser, error) {
+	if r.bodyRead {
+		return nil, errtools.BodyConsumedError("body has already been read")
+	}
+
+	r.bodyRead = true
+
+	return decodeContent(r.Response.Body, r.Response.Header.Get("Content-Encoding"))
+}
+
+// Read the body, decompressing it if the response has a Content-Encoding
+// (gzip, deflate, br or zstd)
 func (r *GResponse) BodyBytes() ([]byte, error) {
+	body, err := r.decodedBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// Read the body as it was received, without decompressing it
+func (r *GResponse) BodyRawBytes() ([]byte, error) {
 	if r.bodyRead {
 		return nil, errtools.BodyConsumedError("body has already been read")
 	}
@@ -38,43 +65,36 @@ func (r *GResponse) BodyString() (string, error) {
 	return string(b), nil
 }
 
+// Get a reader for the decompressed body, which must be closed by the caller
 func (r *GResponse) BodyReader() (*io.ReadCloser, error) {
-	if r.bodyRead {
-		return nil, errtools.BodyConsumedError("body has already been read")
+	body, err := r.decodedBody()
+	if err != nil {
+		return nil, err
 	}
 
-	r.bodyRead = true
-	return &r.Response.Body, nil
+	return &body, nil
 }
 
 func (r *GResponse) BodyUnmarshalJson(v interface{}) error {
-	if r.bodyRead {
-		return errtools.BodyConsumedError("body has already been read")
+	body, err := r.decodedBody()
+	if err != nil {
+		return err
 	}
+	defer body.Close()
 
-	r.bodyRead = true
-	defer r.Response.Body.Close()
-
-	return json.NewDecoder(r.Response.Body).Decode(v)
+	return json.NewDecoder(body).Decode(v)
 }
 
 func (r *GResponse) BodyUnmarshalXml(v interface{}) error {
-	if r.bodyRead {
-		return errtools.BodyConsumedError("body has already been read")
+	body, err := r.decodedBody()
+	if err != nil {
+		return err
 	}
+	defer body.Close()
 
-	r.bodyRead = true
-	defer r.Response.Body.Close()
-
-	return xml.NewDecoder(r.Response.Body).Decode(v)
+	return xml.NewDecoder(body).Decode(v)
 }
 
-// TODO: AutoUnmarshal, detect content type and unmarshal accordingly
-// json: application/json
-// xml: application/xml
-// yml: application/yaml
-// php: application/php
-
 func (r *GResponse) Close() {
 	if r.bodyRead {
 		return
@@ -0,0 +1,50 @@
+package greq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The body of the application/problem+json responses used by the error tests
+const notFoundProblem = `{"code":"not_found","message":"no such pet"}`
+
+// Handlers by request path, the handler for "/" is used for paths without their own handler
+type routes map[string]http.HandlerFunc
+
+func (rs routes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := rs[r.URL.Path]
+	if !ok {
+		handler, ok = rs["/"]
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	handler(w, r)
+}
+
+// Start a test server that is closed when the test ends
+func newTestServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Respond with a fixed status, Content-Type and body
+// The Content-Type is sniffed from the body if it is empty
+func respond(status int, contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
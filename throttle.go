@@ -0,0 +1,212 @@
+package greq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// A token bucket limiting the number of bytes per second
+// A limiter can be shared between requests to cap their combined bandwidth, and
+// between the upload and download of a request to cap the total in both directions.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int64
+	tokens float64
+	last   time.Time
+}
+
+// Create a limiter for the given number of bytes per second
+// The burst, the number of bytes that can be sent at once, defaults to a tenth of
+// a second of bandwidth with a minimum of 1 KiB. A limiter with a rate below 1 does
+// not limit anything, WithUploadLimit and WithDownloadLimit reject such rates.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	burst := bytesPerSecond / 10
+	if burst < 1024 {
+		burst = 1024
+	}
+
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Set the number of bytes that can be sent at once
+func (l *RateLimiter) WithBurst(burst int64) *RateLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.burst = burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+
+	return l
+}
+
+// The largest read that should be made at once
+func (l *RateLimiter) chunkSize() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.burst)
+}
+
+// Take n bytes from the bucket, returning how long to wait before they may be used
+// The bucket can go into debt, so concurrent readers queue up behind each other
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 || l.rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// Limit the upload speed of the request body to the given number of bytes per second
+// The rate must be at least 1
+func (g *GRequest) WithUploadLimit(bytesPerSecond int64) *GRequest {
+	if bytesPerSecond < 1 {
+		g.addError(errtools.InvalidFieldError(fmt.Sprintf("upload limit must be at least 1 byte per second, got %d", bytesPerSecond)))
+		return g
+	}
+
+	return g.WithUploadLimiter(NewRateLimiter(bytesPerSecond))
+}
+
+// Limit the download speed of the response body to the given number of bytes per second
+// The rate must be at least 1
+func (g *GRequest) WithDownloadLimit(bytesPerSecond int64) *GRequest {
+	if bytesPerSecond < 1 {
+		g.addError(errtools.InvalidFieldError(fmt.Sprintf("download limit must be at least 1 byte per second, got %d", bytesPerSecond)))
+		return g
+	}
+
+	return g.WithDownloadLimiter(NewRateLimiter(bytesPerSecond))
+}
+
+// Limit the upload speed with a limiter that can be shared with other requests
+// Multiple limiters can be added, for example a per-request and a shared limit
+func (g *GRequest) WithUploadLimiter(limiter *RateLimiter) *GRequest {
+	if limiter == nil {
+		g.addError(errtools.MissingValueError("upload limiter cannot be nil"))
+		return g
+	}
+
+	g.uploadLimiters = append(g.uploadLimiters, limiter)
+	return g
+}
+
+// Limit the download speed with a limiter that can be shared with other requests
+// Multiple limiters can be added, for example a per-request and a shared limit
+func (g *GRequest) WithDownloadLimiter(limiter *RateLimiter) *GRequest {
+	if limiter == nil {
+		g.addError(errtools.MissingValueError("download limiter cannot be nil"))
+		return g
+	}
+
+	g.downloadLimiters = append(g.downloadLimiters, limiter)
+	return g
+}
+
+// Wrap the body so it is throttled every time it is opened
+func (b *requestBody) withLimiters(ctx context.Context, limiters []*RateLimiter) *requestBody {
+	wrapped := *b
+	wrapped.open = func() (io.ReadCloser, error) {
+		body, err := b.open()
+		if err != nil {
+			return nil, err
+		}
+
+		return newThrottledReader(ctx, body, limiters), nil
+	}
+
+	return &wrapped
+}
+
+// Throttles reading the wrapped body with one or more limiters
+// Waiting for the limiters stops when the context is cancelled or the reader is closed
+type throttledReader struct {
+	body     io.ReadCloser
+	limiters []*RateLimiter
+	ctx      context.Context
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newThrottledReader(ctx context.Context, body io.ReadCloser, limiters []*RateLimiter) *throttledReader {
+	return &throttledReader{body: body, limiters: limiters, ctx: ctx, closed: make(chan struct{})}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Read at most the smallest burst, so a single read never exceeds a limit by much
+	for _, limiter := range t.limiters {
+		if size := limiter.chunkSize(); len(p) > size {
+			p = p[:size]
+		}
+	}
+
+	n, err := t.body.Read(p)
+	if n > 0 {
+		var wait time.Duration
+		for _, limiter := range t.limiters {
+			if d := limiter.reserve(n); d > wait {
+				wait = d
+			}
+		}
+
+		if werr := t.wait(wait); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// Wait for the limiters, returning early with an error if the transfer is cancelled
+func (t *throttledReader) wait(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	case <-t.closed:
+		return http.ErrBodyReadAfterClose
+	}
+}
+
+func (t *throttledReader) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return t.body.Close()
+}
@@ -0,0 +1,146 @@
+package greq_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+func TestBandwidthLimits(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 50*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodGet {
+			w.Write(payload)
+		}
+	}))
+	defer server.Close()
+
+	// 50 KiB at 100 KiB/s with a 10 KiB burst takes at least 0.4 seconds
+	start := time.Now()
+
+	_, err := greq.PostRequest(server.URL).
+		WithByteBody(payload).
+		WithUploadLimit(100 * 1024).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("upload was not throttled, took %s", elapsed)
+	}
+
+	start = time.Now()
+
+	resp, err := greq.GetRequest(server.URL).
+		WithDownloadLimit(100 * 1024).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body) != len(payload) {
+		t.Errorf("unexpected body length %d", len(body))
+	}
+
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("download was not throttled, took %s", elapsed)
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	// Two uploads of 25 KiB share one 100 KiB/s limit, so together they take at least 0.4 seconds
+	limiter := greq.NewRateLimiter(100 * 1024).WithBurst(10 * 1024)
+	payload := bytes.Repeat([]byte("x"), 25*1024)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := greq.PostRequest(server.URL).WithByteBody(payload).WithUploadLimiter(limiter).Execute(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("uploads did not share the limit, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 64*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	// A large burst lets a single read put the limiter deep into debt
+	limiter := greq.NewRateLimiter(1024).WithBurst(64 * 1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp, err := greq.GetRequest(server.URL).WithContext(ctx).WithDownloadLimiter(limiter).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := resp.BodyBytes(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the download to be cancelled, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the wait to stop when the context is cancelled, took %s", elapsed)
+	}
+
+	// The upload is cancelled the same way
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start = time.Now()
+	_, err = greq.PostRequest(server.URL).WithContext(ctx).WithByteBody(payload).WithUploadLimiter(greq.NewRateLimiter(1024).WithBurst(64 * 1024)).Execute()
+	if !errors.Is(err, context.Canceled) || time.Since(start) > 2*time.Second {
+		t.Errorf("expected the upload to be cancelled, got %v after %s", err, time.Since(start))
+	}
+
+	for _, limit := range []int64{0, -1} {
+		if err := greq.GetRequest(server.URL).WithDownloadLimit(limit).Validate(); err == nil {
+			t.Errorf("expected an error for a download limit of %d", limit)
+		}
+
+		if err := greq.GetRequest(server.URL).WithUploadLimit(limit).Validate(); err == nil {
+			t.Errorf("expected an error for an upload limit of %d", limit)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package greq
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TLS settings for a request
+// These are applied on top of the transport set by the client or authorizations,
+// so they can be combined with client certificates
+type TLSOptions struct {
+	// Minimum and maximum TLS versions, for example tls.VersionTLS12
+	MinVersion uint16
+	MaxVersion uint16
+
+	// Cipher suites to use for TLS 1.2 and below
+	CipherSuites []uint16
+
+	// Override the server name sent in the SNI extension and used to verify the certificate
+	ServerName string
+
+	// Root CAs to verify the server with, replacing the system roots
+	RootCAs *x509.CertPool
+
+	// Base64 encoded SHA-256 hashes of the SubjectPublicKeyInfo of pinned certificates,
+	// optionally prefixed with "sha256/". The connection fails unless a certificate in
+	// the chain matches one of the pins
+	PinnedSPKI []string
+
+	InsecureSkipVerify bool
+}
+
+// Returned when none of the certificates presented by the server match the pinned keys
+type PinMismatchError struct {
+	ServerName string
+	// The SPKI hashes of the certificates presented by the server
+	Presented []string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate pin mismatch for %s: presented keys %s do not match any pinned key", e.ServerName, strings.Join(e.Presented, ", "))
+}
+
+// Calculate the base64 encoded SHA-256 hash of the SubjectPublicKeyInfo of a certificate
+// This is the format used by TLSOptions.PinnedSPKI
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Apply the TLS options to a transport
+func (o *TLSOptions) apply(t *http.Transport) error {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	} else {
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+
+	cfg := t.TLSClientConfig
+
+	if o.MinVersion != 0 {
+		cfg.MinVersion = o.MinVersion
+	}
+
+	if o.MaxVersion != 0 {
+		cfg.MaxVersion = o.MaxVersion
+	}
+
+	if o.MinVersion != 0 && o.MaxVersion != 0 && o.MinVersion > o.MaxVersion {
+		return fmt.Errorf("tls min version cannot be higher than the max version")
+	}
+
+	if len(o.CipherSuites) > 0 {
+		cfg.CipherSuites = o.CipherSuites
+	}
+
+	if o.ServerName != "" {
+		cfg.ServerName = o.ServerName
+	}
+
+	if o.RootCAs != nil {
+		cfg.RootCAs = o.RootCAs
+	}
+
+	if o.InsecureSkipVerify {
+		cfg.InsecureSkipVerify = true
+	}
+
+	if len(o.PinnedSPKI) > 0 {
+		pins := make(map[string]bool, len(o.PinnedSPKI))
+		for _, pin := range o.PinnedSPKI {
+			pins[strings.TrimPrefix(pin, "sha256/")] = true
+		}
+
+		previous := cfg.VerifyConnection
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if previous != nil {
+				if err := previous(cs); err != nil {
+					return err
+				}
+			}
+
+			return verifyPins(cs, pins)
+		}
+	}
+
+	return nil
+}
+
+// Check that a certificate in the verified chains matches one of the pins
+// If the chain was not verified by the standard library, only the leaf certificate
+// is checked, since the server has not proven ownership of the other certificates
+func verifyPins(cs tls.ConnectionState, pins map[string]bool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return &PinMismatchError{ServerName: cs.ServerName}
+	}
+
+	certs := []*x509.Certificate{cs.PeerCertificates[0]}
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+
+	for _, cert := range certs {
+		if pins[SPKIHash(cert)] {
+			return nil
+		}
+	}
+
+	presented := make([]string, 0, len(cs.PeerCertificates))
+	for _, cert := range cs.PeerCertificates {
+		presented = append(presented, SPKIHash(cert))
+	}
+
+	return &PinMismatchError{ServerName: cs.ServerName, Presented: presented}
+}
@@ -0,0 +1,117 @@
+package greq_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+func newTLSTestServer() (*httptest.Server, *x509.CertPool) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	return server, pool
+}
+
+func TestTLSConfigRootCAs(t *testing.T) {
+	server, pool := newTLSTestServer()
+	defer server.Close()
+
+	if _, err := greq.GetRequest(server.URL).Execute(); err == nil {
+		t.Fatal("expected an error without the test server CA")
+	}
+
+	resp, err := greq.GetRequest(server.URL).WithTLSConfig(greq.TLSOptions{RootCAs: pool}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+
+	if resp.Response.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("unexpected tls version %x", resp.Response.TLS.Version)
+	}
+}
+
+func TestTLSConfigMinVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	_, err := greq.GetRequest(server.URL).
+		TlsSetNovalidate().
+		WithTLSConfig(greq.TLSOptions{MinVersion: tls.VersionTLS13}).
+		Execute()
+	if err == nil {
+		t.Fatal("expected an error when the server does not support the minimum tls version")
+	}
+}
+
+func TestTLSConfigPinning(t *testing.T) {
+	server, pool := newTLSTestServer()
+	defer server.Close()
+
+	pin := greq.SPKIHash(server.Certificate())
+
+	resp, err := greq.GetRequest(server.URL).
+		WithTLSConfig(greq.TLSOptions{RootCAs: pool, PinnedSPKI: []string{"sha256/" + pin}}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	_, err = greq.GetRequest(server.URL).
+		WithTLSConfig(greq.TLSOptions{RootCAs: pool, PinnedSPKI: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}).
+		Execute()
+
+	var pinErr *greq.PinMismatchError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("expected a pin mismatch error, got %v", err)
+	}
+
+	if len(pinErr.Presented) == 0 || pinErr.Presented[0] != pin {
+		t.Errorf("expected the presented pin %s, got %v", pin, pinErr.Presented)
+	}
+}
+
+func TestTLSConfigWithClientCertificate(t *testing.T) {
+	ca := PrepareCA()
+	serverCert := ca.CreateServerCert()
+	clientCert := ca.CreateClientCert()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.CaPEM)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.Cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// The server certificate is issued for localhost, so the server name is overridden
+	resp, err := greq.GetRequest(server.URL).
+		WithAuth(&greq.ClientCertificateAuth{ClientCertificate: clientCert.Cert}).
+		WithTLSConfig(greq.TLSOptions{RootCAs: pool, ServerName: "localhost"}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,257 @@
+package greq
+
+import (
+	"container/list"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// Merge two transports set by different authorizations into one
+// Settings from the first transport are kept, and the TLS settings of
+// the second transport are merged into them:
+// - client certificates are combined, it is an error if one transport loads them dynamically
+// - root CAs are taken from whichever transport sets them, it is an error if both do
+// - InsecureSkipVerify is enabled if either transport enables it
+// - certificate and verification callbacks are taken from whichever transport sets them
+// - HTTP/1.1 is forced if either transport forces it
+// Wrapping transports (NTLM) keep wrapping the merged transport, but only one
+// wrapping transport can be present.
+func mergeTransports(first, second http.RoundTripper) (http.RoundTripper, error) {
+	if first == nil {
+		return second, nil
+	}
+
+	if second == nil {
+		return first, nil
+	}
+
+	switch ft := first.(type) {
+	case ntlmssp.Negotiator:
+		if _, ok := second.(ntlmssp.Negotiator); ok {
+			return nil, fmt.Errorf("cannot merge two ntlm transports")
+		}
+
+		inner, err := mergeTransports(ft.RoundTripper, second)
+		if err != nil {
+			return nil, err
+		}
+
+		return ntlmssp.Negotiator{RoundTripper: inner}, nil
+
+	case *http.Transport:
+		switch st := second.(type) {
+		case ntlmssp.Negotiator:
+			return mergeTransports(second, first)
+		case *http.Transport:
+			merged := ft.Clone()
+			if err := mergeTransportSettings(merged, st); err != nil {
+				return nil, err
+			}
+
+			return merged, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot merge transports of type %T and %T", first, second)
+}
+
+// Merge the TLS and protocol settings from src into dst
+func mergeTransportSettings(dst, src *http.Transport) error {
+	if src.TLSNextProto != nil && len(src.TLSNextProto) == 0 {
+		dst.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if src.TLSClientConfig == nil {
+		return nil
+	}
+
+	if dst.TLSClientConfig == nil {
+		dst.TLSClientConfig = src.TLSClientConfig.Clone()
+		return nil
+	}
+
+	dst.TLSClientConfig.Certificates = append(dst.TLSClientConfig.Certificates, src.TLSClientConfig.Certificates...)
+
+	if src.TLSClientConfig.GetClientCertificate != nil {
+		if dst.TLSClientConfig.GetClientCertificate != nil {
+			return fmt.Errorf("cannot merge transports that both load client certificates dynamically")
+		}
+
+		dst.TLSClientConfig.GetClientCertificate = src.TLSClientConfig.GetClientCertificate
+	}
+
+	if src.TLSClientConfig.VerifyConnection != nil {
+		if dst.TLSClientConfig.VerifyConnection != nil {
+			return fmt.Errorf("cannot merge transports that both verify the connection")
+		}
+
+		dst.TLSClientConfig.VerifyConnection = src.TLSClientConfig.VerifyConnection
+	}
+
+	// A certificate callback replaces the static certificates, so they cannot be combined
+	if dst.TLSClientConfig.GetClientCertificate != nil && len(dst.TLSClientConfig.Certificates) > 0 {
+		return fmt.Errorf("cannot merge static client certificates with a transport that loads them dynamically")
+	}
+
+	dst.TLSClientConfig.InsecureSkipVerify = dst.TLSClientConfig.InsecureSkipVerify || src.TLSClientConfig.InsecureSkipVerify
+
+	if src.TLSClientConfig.RootCAs != nil {
+		if dst.TLSClientConfig.RootCAs != nil && !dst.TLSClientConfig.RootCAs.Equal(src.TLSClientConfig.RootCAs) {
+			return fmt.Errorf("cannot merge transports with different root CAs")
+		}
+
+		dst.TLSClientConfig.RootCAs = src.TLSClientConfig.RootCAs
+	}
+
+	return nil
+}
+
+// Replace the *http.Transport underneath a round tripper with the result of build
+// build receives a copy of the transport, or of the default transport if none has been set,
+// and wrapping transports (NTLM) keep wrapping the result
+func rebuildTransport(rt http.RoundTripper, build func(t *http.Transport) (http.RoundTripper, error)) (http.RoundTripper, error) {
+	switch vt := rt.(type) {
+	case nil:
+		return build(http.DefaultTransport.(*http.Transport).Clone())
+
+	case *http.Transport:
+		return build(vt.Clone())
+
+	case ntlmssp.Negotiator:
+		inner, err := rebuildTransport(vt.RoundTripper, build)
+		if err != nil {
+			return nil, err
+		}
+
+		return ntlmssp.Negotiator{RoundTripper: inner}, nil
+	}
+
+	return nil, fmt.Errorf("cannot apply transport settings to a transport of type %T", rt)
+}
+
+// The number of configured transports that are kept for reuse
+const transportCacheSize = 64
+
+// Identifies the transport built for a base transport and the request level settings
+// Every pointer in the key is also referenced by the cached transport, so an address
+// cannot be reused for a different value while the entry exists
+type transportKey struct {
+	base     http.RoundTripper
+	resolver Resolver
+	version  HTTPVersion
+	settings string
+}
+
+type cachedTransport struct {
+	key       transportKey
+	transport http.RoundTripper
+}
+
+// Transports built for request level settings, so requests with the same settings share a
+// connection pool. The least recently used transport is evicted and its idle connections closed.
+type transportCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[transportKey]*list.Element
+	order   *list.List
+}
+
+var transports = newTransportCache(transportCacheSize)
+
+func newTransportCache(size int) *transportCache {
+	return &transportCache{
+		size:    size,
+		entries: make(map[transportKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get the transport for a key, building and caching it if it does not exist
+func (c *transportCache) get(key transportKey, build func() (http.RoundTripper, error)) (http.RoundTripper, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cachedTransport).transport, nil
+	}
+
+	transport, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	c.entries[key] = c.order.PushFront(&cachedTransport{key: key, transport: transport})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*cachedTransport)
+		delete(c.entries, oldest.key)
+		closeIdleConnections(oldest.transport)
+	}
+
+	return transport, nil
+}
+
+// Build the cache key for the request level settings
+// Returns false if the base transport or resolver cannot be compared safely, for example
+// a struct value that holds a func or a map
+func (g *GRequest) transportKey() (transportKey, bool) {
+	key := transportKey{base: g.client.Transport, version: g.httpVersion}
+	if !cacheableValue(key.base) {
+		return key, false
+	}
+
+	settings := &strings.Builder{}
+
+	if o := g.tlsOptions; o != nil {
+		fmt.Fprintf(settings, "tls:%d,%d,%v,%q,%p,%q,%t;", o.MinVersion, o.MaxVersion, o.CipherSuites, o.ServerName, o.RootCAs, o.PinnedSPKI, o.InsecureSkipVerify)
+	}
+
+	if d := g.dial; d != nil {
+		if !cacheableValue(d.resolver) {
+			return key, false
+		}
+		key.resolver = d.resolver
+
+		// fmt prints maps sorted by key
+		fmt.Fprintf(settings, "dial:%v,%q,%v,%q;", d.resolve, d.family, d.localAddr, d.unixSocket)
+
+		if p := d.egress; p != nil {
+			fmt.Fprintf(settings, "egress:%t,%q,%q,%q,%v;", p.DenyPrivate, p.DeniedNetworks, p.AllowedNetworks, p.AllowedHosts, p.AllowedPorts)
+		}
+	}
+
+	key.settings = settings.String()
+	return key, true
+}
+
+// Only nil and pointers are used in cache keys, other values may not be comparable
+func cacheableValue(v interface{}) bool {
+	return v == nil || reflect.TypeOf(v).Kind() == reflect.Pointer
+}
+
+func closeIdleConnections(rt http.RoundTripper) {
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Closes the idle connections of a transport that is not reused when the body is closed
+type closeIdleBody struct {
+	io.ReadCloser
+	transport http.RoundTripper
+}
+
+func (b *closeIdleBody) Close() error {
+	err := b.ReadCloser.Close()
+	closeIdleConnections(b.transport)
+
+	return err
+}
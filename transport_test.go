@@ -0,0 +1,58 @@
+package greq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/clysec/greq"
+)
+
+// Wait for goroutines of closed connections to exit, returning the number left
+func settledGoroutines(limit int) int {
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > limit && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return runtime.NumGoroutine()
+}
+
+func TestTransportReuse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	requests := map[string]func() *greq.GRequest{
+		// The same settings share one transport
+		"cached": func() *greq.GRequest {
+			return greq.GetRequest(server.URL).WithIPFamily(greq.PreferIPv4)
+		},
+		// A map resolver cannot be part of a cache key, so its idle connections are closed
+		"uncached": func() *greq.GRequest {
+			return greq.GetRequest(server.URL).WithResolver(fakeResolver{})
+		},
+	}
+
+	for name, newRequest := range requests {
+		before := runtime.NumGoroutine()
+
+		for i := 0; i < 50; i++ {
+			resp, err := newRequest().Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := resp.BodyString(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if after := settledGoroutines(before + 5); after > before+5 {
+			t.Errorf("%s: expected the connections to be reused or closed, %d goroutines before and %d after", name, before, after)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package greq
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Send the request over a unix domain socket
+// The host in the URL is only used for the Host header, for example
+// GetRequest("http://localhost/v1.41/info").WithUnixSocket("/var/run/docker.sock")
+//
+// The socket can also be given in the URL, either as unix:///var/run/docker.sock/v1.41/info,
+// where the socket is the longest part of the path that is a socket on disk, or as
+// http+unix://%2Fvar%2Frun%2Fdocker.sock/v1.41/info with the socket path escaped as the host
+func (g *GRequest) WithUnixSocket(socketPath string) *GRequest {
+	if socketPath == "" {
+		g.addError(fmt.Errorf("unix socket path cannot be empty"))
+		return g
+	}
+
+	g.dialOptions().unixSocket = socketPath
+	return g
+}
+
+// Rewrite unix:// and http+unix:// URLs to http:// URLs, returning the socket path
+// Other URLs are returned unchanged with an empty socket path
+func splitUnixURL(rawUrl string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(rawUrl, "http+unix://"):
+		// url.Parse does not accept escaped slashes in the host, so it is split manually
+		host, rest, _ := strings.Cut(strings.TrimPrefix(rawUrl, "http+unix://"), "/")
+
+		socket, err := url.PathUnescape(host)
+		if err != nil {
+			return "", "", err
+		}
+
+		return "http://localhost/" + rest, socket, nil
+
+	case strings.HasPrefix(rawUrl, "unix://"):
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return "", "", err
+		}
+
+		socket, requestPath, err := findUnixSocket(u.Path)
+		if err != nil {
+			return "", "", err
+		}
+
+		u.Scheme = "http"
+		u.Host = "localhost"
+		u.Path = requestPath
+		u.RawPath = ""
+
+		return u.String(), socket, nil
+	}
+
+	return rawUrl, "", nil
+}
+
+// Split a path into the socket on disk and the request path after it
+func findUnixSocket(fullPath string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(fullPath, "/"), "/")
+
+	for i := len(parts); i > 0; i-- {
+		candidate := "/" + path.Join(parts[:i]...)
+
+		info, err := os.Stat(candidate)
+		if err != nil || info.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+
+		return candidate, "/" + strings.Join(parts[i:], "/"), nil
+	}
+
+	return "", "", fmt.Errorf("no unix socket found in path %s", fullPath)
+}
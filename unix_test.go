@@ -0,0 +1,77 @@
+package greq_test
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+func startUnixServer(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
+
+	// Socket paths have a short length limit, so t.TempDir is not used
+	dir, err := os.MkdirTemp("", "greq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "api.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `","query":"` + r.URL.RawQuery + `"}`))
+	})}
+
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return socket
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := startUnixServer(t)
+
+	urls := map[string]*greq.GRequest{
+		"WithUnixSocket": greq.GetRequest("http://localhost/v1.41/info").WithUnixSocket(socket),
+		"unix":           greq.GetRequest("unix://" + socket + "/v1.41/info"),
+		"http+unix":      greq.GetRequest("http+unix://" + url.PathEscape(socket) + "/v1.41/info"),
+	}
+
+	for name, request := range urls {
+		t.Run(name, func(t *testing.T) {
+			resp, err := request.WithQueryParam("all", "1").Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body map[string]string
+			if err := resp.BodyUnmarshalJson(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if body["path"] != "/v1.41/info" || body["query"] != "all=1" {
+				t.Errorf("unexpected request %v", body)
+			}
+		})
+	}
+}
+
+func TestUnixSocketNotFound(t *testing.T) {
+	if _, err := greq.GetRequest("unix:///does/not/exist.sock/info").Execute(); err == nil {
+		t.Fatal("expected an error when no socket is found")
+	}
+}
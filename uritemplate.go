@@ -0,0 +1,302 @@
+package greq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/typetools"
+)
+
+// Set a variable for the RFC 6570 URI template in the request URL
+// The value can be a string-like or numeric value, a []string for lists or a
+// map[string]string for associative arrays, for example:
+// GetRequest("https://api.github.com/repos/{owner}/{repo}/contents/{+path}{?ref}").
+// WithPathParam("owner", "clysec").WithPathParam("repo", "greq").WithPathParam("path", "docs/index.md")
+//
+// Variables used outside of query expressions ({?var} and {&var}) are required,
+// and a missing variable is reported by Validate. The URL is only treated as a
+// template once a path parameter is set, so URLs with literal braces keep working.
+func (g *GRequest) WithPathParam(name string, value interface{}) *GRequest {
+	normalized, err := templateValue(value)
+	if err != nil {
+		g.addError(errtools.InvalidTypeError(fmt.Sprintf("path parameter %s: %s", name, err)))
+		return g
+	}
+
+	if g.pathParams == nil {
+		g.pathParams = make(map[string]interface{})
+	}
+
+	g.pathParams[name] = normalized
+	return g
+}
+
+// Set multiple variables for the URI template in the request URL, see WithPathParam
+// An empty map expands a template that only has optional query expressions.
+func (g *GRequest) WithPathParams(params map[string]interface{}) *GRequest {
+	if g.pathParams == nil {
+		g.pathParams = make(map[string]interface{})
+	}
+
+	for k, v := range params {
+		g.WithPathParam(k, v)
+	}
+
+	return g
+}
+
+// Whether the URL is a template, which is the case once path parameters are set
+func (g *GRequest) isTemplate() bool {
+	return g.pathParams != nil
+}
+
+// Normalize a template value to a string, []string or []templatePair
+func templateValue(value interface{}) (interface{}, error) {
+	switch vt := value.(type) {
+	case []string:
+		return vt, nil
+	case map[string]string:
+		keys := make([]string, 0, len(vt))
+		for k := range vt {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]templatePair, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, templatePair{k, vt[k]})
+		}
+
+		return pairs, nil
+	case bool:
+		return strconv.FormatBool(vt), nil
+	}
+
+	if typetools.IsStringlikeType(value) || typetools.IsNumericType(value) {
+		return typetools.EnsureString(value), nil
+	}
+
+	return nil, fmt.Errorf("value must be a string-like, numeric, []string or map[string]string type")
+}
+
+type templatePair struct {
+	key   string
+	value string
+}
+
+// Settings for each expression operator, from RFC 6570 appendix A
+type templateOperator struct {
+	first         string
+	sep           string
+	named         bool
+	ifEmpty       string
+	allowReserved bool
+}
+
+var templateOperators = map[byte]templateOperator{
+	0:   {first: "", sep: ","},
+	'+': {first: "", sep: ",", allowReserved: true},
+	'.': {first: ".", sep: "."},
+	'/': {first: "/", sep: "/"},
+	';': {first: ";", sep: ";", named: true},
+	'?': {first: "?", sep: "&", named: true, ifEmpty: "="},
+	'&': {first: "&", sep: "&", named: true, ifEmpty: "="},
+	'#': {first: "#", sep: ",", allowReserved: true},
+}
+
+// Expand an RFC 6570 URI template with the given variables
+func expandTemplate(template string, vars map[string]interface{}) (string, error) {
+	var out strings.Builder
+
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			out.WriteString(template)
+			return out.String(), nil
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return "", errtools.InvalidFieldError("url template has an unclosed expression")
+		}
+
+		out.WriteString(template[:start])
+
+		expanded, err := expandExpression(template[start+1:start+end], vars)
+		if err != nil {
+			return "", err
+		}
+
+		out.WriteString(expanded)
+		template = template[start+end+1:]
+	}
+}
+
+func expandExpression(expr string, vars map[string]interface{}) (string, error) {
+	if expr == "" {
+		return "", errtools.InvalidFieldError("url template has an empty expression")
+	}
+
+	opChar := byte(0)
+	if _, ok := templateOperators[expr[0]]; ok {
+		opChar = expr[0]
+		expr = expr[1:]
+	}
+
+	op := templateOperators[opChar]
+
+	var parts []string
+
+	for _, spec := range strings.Split(expr, ",") {
+		name := spec
+		explode := false
+		prefix := -1
+
+		if strings.HasSuffix(name, "*") {
+			explode = true
+			name = strings.TrimSuffix(name, "*")
+		} else if n, p, found := strings.Cut(name, ":"); found {
+			length, err := strconv.Atoi(p)
+			if err != nil || length < 1 || length > 9999 {
+				return "", errtools.InvalidFieldError(fmt.Sprintf("url template has an invalid prefix length in %s", spec))
+			}
+
+			name = n
+			prefix = length
+		}
+
+		if name == "" {
+			return "", errtools.InvalidFieldError("url template has an empty variable name")
+		}
+
+		value, ok := vars[name]
+		if !ok {
+			// Query parameters are optional, everything else is required
+			if opChar == '?' || opChar == '&' {
+				continue
+			}
+
+			return "", errtools.MissingValueError(fmt.Sprintf("url template variable %s", name))
+		}
+
+		if part, defined := expandValue(name, value, op, explode, prefix); defined {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	return op.first + strings.Join(parts, op.sep), nil
+}
+
+// Expand a single variable, returning false if it is undefined (an empty list or map)
+func expandValue(name string, value interface{}, op templateOperator, explode bool, prefix int) (string, bool) {
+	encode := func(s string) string {
+		return templateEncode(s, op.allowReserved)
+	}
+
+	named := func(v string) string {
+		if !op.named {
+			return v
+		}
+
+		if v == "" {
+			return name + op.ifEmpty
+		}
+
+		return name + "=" + v
+	}
+
+	switch vt := value.(type) {
+	case string:
+		if prefix > 0 && utf8.RuneCountInString(vt) > prefix {
+			vt = string([]rune(vt)[:prefix])
+		}
+
+		return named(encode(vt)), true
+
+	case []string:
+		if len(vt) == 0 {
+			return "", false
+		}
+
+		items := make([]string, 0, len(vt))
+		for _, item := range vt {
+			if explode {
+				items = append(items, named(encode(item)))
+			} else {
+				items = append(items, encode(item))
+			}
+		}
+
+		if explode {
+			return strings.Join(items, op.sep), true
+		}
+
+		return named(strings.Join(items, ",")), true
+
+	case []templatePair:
+		if len(vt) == 0 {
+			return "", false
+		}
+
+		items := make([]string, 0, len(vt))
+		for _, pair := range vt {
+			if explode {
+				if op.named && pair.value == "" {
+					items = append(items, encode(pair.key)+op.ifEmpty)
+				} else {
+					items = append(items, encode(pair.key)+"="+encode(pair.value))
+				}
+			} else {
+				items = append(items, encode(pair.key), encode(pair.value))
+			}
+		}
+
+		if explode {
+			return strings.Join(items, op.sep), true
+		}
+
+		return named(strings.Join(items, ",")), true
+	}
+
+	return "", false
+}
+
+// Percent-encode a value, keeping unreserved characters and optionally
+// reserved characters and existing percent-encoded triplets
+func templateEncode(s string, allowReserved bool) string {
+	const hex = "0123456789ABCDEF"
+
+	var out strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte("-._~", c) >= 0:
+			out.WriteByte(c)
+		case allowReserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", c) >= 0:
+			out.WriteByte(c)
+		case allowReserved && c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			out.WriteString(s[i : i+3])
+			i += 2
+		default:
+			out.WriteByte('%')
+			out.WriteByte(hex[c>>4])
+			out.WriteByte(hex[c&0x0f])
+		}
+	}
+
+	return out.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
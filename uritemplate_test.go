@@ -0,0 +1,107 @@
+package greq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clysec/greq"
+)
+
+func TestPathParams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RequestURI))
+	}))
+	defer server.Close()
+
+	params := map[string]interface{}{
+		"var":   "value",
+		"hello": "Hello World!",
+		"path":  "/foo/bar",
+		"list":  []string{"red", "green", "blue"},
+		"keys":  map[string]string{"semi": ";", "dot": ".", "comma": ","},
+		"owner": "clysec",
+		"repo":  "a/b c",
+		"id":    42,
+	}
+
+	// Examples from RFC 6570
+	tests := map[string]string{
+		"/repos/{owner}/{repo}/{id}": "/repos/clysec/a%2Fb%20c/42",
+		"/t/{var}":                   "/t/value",
+		"/t/{hello}":                 "/t/Hello%20World%21",
+		"/t/{+hello}":                "/t/Hello%20World!",
+		"/t{+path}/here":             "/t/foo/bar/here",
+		"/t/X{.list}":                "/t/X.red,green,blue",
+		"/t{/list*,path:4}":          "/t/red/green/blue/%2Ffoo",
+		"/t/{;keys*}":                "/t/;comma=%2C;dot=.;semi=%3B",
+		"/t{?list*}":                 "/t?list=red&list=green&list=blue",
+		"/t{?var,missing}{&keys}":    "/t?var=value&keys=comma,%2C,dot,.,semi,%3B",
+	}
+
+	for template, expected := range tests {
+		resp, err := greq.GetRequest(server.URL + template).WithPathParams(params).Execute()
+		if err != nil {
+			t.Fatalf("%s: %v", template, err)
+		}
+
+		body, err := resp.BodyString()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body != expected {
+			t.Errorf("%s: expected %s, got %s", template, expected, body)
+		}
+	}
+}
+
+func TestPathParamsValidation(t *testing.T) {
+	invalid := []*greq.GRequest{
+		greq.GetRequest("http://localhost/repos/{owner}/{repo}").WithPathParam("owner", "clysec"),
+		greq.GetRequest("http://localhost/repos/{owner").WithPathParam("owner", "clysec"),
+		greq.GetRequest("http://localhost/repos/{owner}").WithPathParam("owner", struct{}{}),
+	}
+
+	for _, request := range invalid {
+		if err := request.Validate(); err == nil {
+			t.Errorf("expected %s to fail validation", request.Url)
+		}
+	}
+
+	request := greq.GetRequest("http://localhost/search{?q,page}").WithPathParam("q", "greq")
+	if err := request.Validate(); err != nil {
+		t.Errorf("expected optional query variables to pass validation: %v", err)
+	}
+
+	// Without path parameters the URL is not a template, so literal braces are allowed
+	request = greq.GetRequest(`http://localhost/search?q={"a":1}`)
+	if err := request.Validate(); err != nil {
+		t.Errorf("expected a literal brace to pass validation: %v", err)
+	}
+}
+
+func TestLiteralBraces(t *testing.T) {
+	server := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("q")))
+	}))
+
+	resp, err := greq.GetRequest(server.URL + `/search?q={"a":1}`).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyString(); body != `{"a":1}` {
+		t.Errorf("expected the query to be sent as it is, got %q", body)
+	}
+
+	// An empty map opts in to expanding optional query expressions
+	resp, err = greq.GetRequest(server.URL + "/search{?q}").WithPathParams(map[string]interface{}{}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Response.Request.URL.RequestURI() != "/search" {
+		t.Errorf("expected the template to be expanded, got %s", resp.Response.Request.URL.RequestURI())
+	}
+}